@@ -6,9 +6,11 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 
 	"aspnet.com/benchmark"
 	"aspnet.com/metrics"
+	"aspnet.com/util"
 )
 
 // SubjectMap defines the mapping from a string name to the given testing subject implementation.
@@ -20,6 +22,16 @@ var SubjectMap = map[string]benchmark.Subject{
 	"signalr:json:broadcast":    &benchmark.SignalrCoreJsonBroadcast{},
 	"signalr:msgpack:echo":      &benchmark.SignalrCoreMsgpackEcho{},
 	"signalr:msgpack:broadcast": &benchmark.SignalrCoreMsgpackBroadcast{},
+	"signalr:json:streaming":    &benchmark.SignalrCoreJsonStreaming{},
+	"signalr:msgpack:streaming": &benchmark.SignalrCoreMsgpackStreaming{},
+	// signalr core over long polling
+	"signalr:longpolling:json:echo":         &benchmark.SignalrLongPollingJsonEcho{},
+	"signalr:longpolling:json:broadcast":    &benchmark.SignalrLongPollingJsonBroadcast{},
+	"signalr:longpolling:msgpack:echo":      &benchmark.SignalrLongPollingMsgpackEcho{},
+	"signalr:longpolling:msgpack:broadcast": &benchmark.SignalrLongPollingMsgpackBroadcast{},
+	// signalr core over server-sent events
+	"signalr:sse:json:echo":      &benchmark.SignalrSSEJsonEcho{},
+	"signalr:sse:json:broadcast": &benchmark.SignalrSSEJsonBroadcast{},
 	// signalr service
 	"signalr:service:json:echo":              &benchmark.SignalrServiceJsonEcho{},
 	"signalr:service:msgpack:echo":           &benchmark.SignalrServiceMsgpackEcho{},
@@ -27,6 +39,9 @@ var SubjectMap = map[string]benchmark.Subject{
 	"signalr:service:msgpack:broadcast":      &benchmark.SignalrServiceMsgpackBroadcast{},
 	"signalr:service:json:groupbroadcast":    &benchmark.SignalrServiceJsonGroupBroadcast{},
 	"signalr:service:msgpack:groupbroadcast": &benchmark.SignalrServiceMsgpackGroupBroadcast{},
+	"signalr:service:json:rest":              &benchmark.SignalrServiceRest{},
+	// signalr hub defined by --scenario
+	"signalr:scenario": &benchmark.SignalrScenario{},
 	// tls
 	"tls:connect": &benchmark.TlsConnect{},
 }
@@ -34,6 +49,8 @@ var SubjectMap = map[string]benchmark.Subject{
 // Controller stands for a single agent and exposes management interfaces.
 type Controller struct {
 	AgentRole string
+	// SourceIPs are the local IPs of this agent to bind the outgoing connections to.
+	SourceIPs []string
 	Subject   benchmark.Subject
 }
 
@@ -57,6 +74,7 @@ func (c *Controller) Setup(config *benchmark.Config, reply *SetupReply) error {
 		return fmt.Errorf("Cannot find subject: " + config.Subject)
 	}
 	c.Subject = subject
+	config.SourceIPs = c.SourceIPs
 	if err := c.Subject.Setup(config, subject); err != nil {
 		return err
 	}
@@ -66,10 +84,46 @@ func (c *Controller) Setup(config *benchmark.Config, reply *SetupReply) error {
 	return nil
 }
 
-func (c *Controller) CollectCounters(args *struct{}, result *map[string]int64) error {
-	for k, v := range c.Subject.Counters() {
-		(*result)[k] += v
+func (c *Controller) CollectCounters(args *struct{}, result *util.MetricsSnapshot) error {
+	*result = *c.Subject.Counters()
+	return nil
+}
+
+// PingArgs starts a NTP style clock synchronization exchange from the master.
+type PingArgs struct {
+	// MasterSendTime is the master clock in unix nanoseconds when the ping was sent.
+	MasterSendTime int64
+}
+
+type PingReply struct {
+	MasterSendTime int64
+	// AgentReceiveTime and AgentSendTime are the agent clock in unix nanoseconds
+	// when the ping was received and when the reply was sent.
+	AgentReceiveTime int64
+	AgentSendTime    int64
+}
+
+// Ping replies the local clock to the master without any offset correction,
+// so that the master can estimate the clock offset and round trip time of the agent.
+func (c *Controller) Ping(args *PingArgs, reply *PingReply) error {
+	reply.AgentReceiveTime = time.Now().UnixNano()
+	reply.MasterSendTime = args.MasterSendTime
+	reply.AgentSendTime = time.Now().UnixNano()
+	return nil
+}
+
+type SetClockOffsetArgs struct {
+	// Offset is the agent clock minus the master clock.
+	Offset     time.Duration
+	ErrorBound time.Duration
+}
+
+// SetClockOffset makes the agent correct its timestamps to the master clock.
+func (c *Controller) SetClockOffset(args *SetClockOffsetArgs, reply *struct{}) error {
+	if util.ClockOffset() != args.Offset {
+		log.Printf("Clock offset to master: %v (+/- %v)", args.Offset, args.ErrorBound)
 	}
+	util.SetClockOffset(args.Offset)
 	return nil
 }
 
@@ -5,34 +5,106 @@ import (
 	"flag"
 	"fmt"
 	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
-type Counters struct {
-	InProgress  int `json:"connection:inprogress"`
-	Established int `json:"connection:established"`
-	Error       int `json:"error"`
-	Success     int `json:"success"`
-	Send        int `json:"message:sent"`
-	Recv        int `json:"message:received"`
-	SendSize    int `json:"message:recvSize"`
-	RecvSize    int `json:"message:sendSize"`
-	LT_100      int `json:"message:lt:100"`
-	LT_200      int `json:"message:lt:200"`
-	LT_300      int `json:"message:lt:300"`
-	LT_400      int `json:"message:lt:400"`
-	LT_500      int `json:"message:lt:500"`
-	LT_600      int `json:"message:lt:600"`
-	LT_700      int `json:"message:lt:700"`
-	LT_800      int `json:"message:lt:800"`
-	LT_900      int `json:"message:lt:900"`
-	LT_1000     int `json:"message:lt:1000"`
-	GE_1000     int `json:"message:ge:1000"`
-}
-
+// Monitor is a row of counters.txt written by the master.
+// Counters only accumulate while Gauges go up and down, so rates are only computed from Counters.
 type Monitor struct {
 	Timestamp string `json:"Time"`
-	Counters  Counters
+	Counters  map[string]int64
+	Gauges    map[string]int64
+}
+
+// legacyGauges are the gauges which were written into Counters before metrics were typed.
+var legacyGauges = map[string]bool{
+	"connection:inprogress":  true,
+	"connection:established": true,
+	"connection:closing":     true,
+	"connection:groupjoin":   true,
+	"message:groupjoin":      true,
+}
+
+func (m *Monitor) isGauge(name string) bool {
+	if _, ok := m.Gauges[name]; ok {
+		return true
+	}
+	return m.Gauges == nil && legacyGauges[name]
+}
+
+// value returns the value of a counter or a gauge.
+func (m *Monitor) value(name string) int64 {
+	if v, ok := m.Gauges[name]; ok {
+		return v
+	}
+	return m.Counters[name]
+}
+
+// counterNames lists the names of the counters which rates can be computed from.
+func (m *Monitor) counterNames() []string {
+	names := make([]string, 0, len(m.Counters))
+	for k := range m.Counters {
+		if !m.isGauge(k) {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// latencyBuckets lists the latency bucket counters ordered by their bounds.
+func (m *Monitor) latencyBuckets() []string {
+	type bucket struct {
+		name  string
+		bound float64
+		ge    bool
+	}
+	buckets := []bucket{}
+	for k := range m.Counters {
+		var rest string
+		var ge bool
+		if strings.HasPrefix(k, "message:lt:") {
+			rest = strings.TrimPrefix(k, "message:lt:")
+		} else if strings.HasPrefix(k, "message:ge:") {
+			rest, ge = strings.TrimPrefix(k, "message:ge:"), true
+		} else {
+			continue
+		}
+		bound, err := strconv.ParseFloat(rest, 64)
+		if err != nil {
+			continue
+		}
+		buckets = append(buckets, bucket{k, bound, ge})
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		if buckets[i].bound != buckets[j].bound {
+			return buckets[i].bound < buckets[j].bound
+		}
+		return !buckets[i].ge
+	})
+	names := make([]string, len(buckets))
+	for i, b := range buckets {
+		names[i] = b.name
+	}
+	return names
+}
+
+func latencyLabel(name string) string {
+	parts := strings.SplitN(name, ":", 3)
+	return strings.ToUpper(parts[1]) + parts[2]
+}
+
+func rateInterval(prev, cur *Monitor) float64 {
+	t0, _ := time.Parse(time.RFC3339, prev.Timestamp)
+	t1, _ := time.Parse(time.RFC3339, cur.Timestamp)
+	seconds := t1.Sub(t0).Seconds()
+	if seconds <= 0 {
+		seconds = 1
+	}
+	return seconds
 }
 
 func main() {
@@ -45,10 +117,13 @@ func main() {
 	rate = false
 	var sizerate bool
 	sizerate = false
+	var rates bool
+	rates = false
 	flag.BoolVar(&all, "all", false, "Print all information")
 	flag.BoolVar(&lastLatency, "lastlatency", false, "Print the last item of latency")
 	flag.BoolVar(&rate, "rate", false, "Print send/recv rate")
 	flag.BoolVar(&sizerate, "sizerate", false, "Print send/recv size rate")
+	flag.BoolVar(&rates, "rates", false, "Print per second rate of every counter")
 
 	flag.Usage = func() {
 		fmt.Println("-input <input_file> : specify the input file")
@@ -56,6 +131,7 @@ func main() {
 		fmt.Println("-all		 : print all information")
 		fmt.Println("-rate               : print send/recv rate")
 		fmt.Println("-sizerate           : print send/recv message size rate")
+		fmt.Println("-rates              : print per second rate of every counter (gauges have no rate)")
 	}
 	flag.Parse()
 	if infile == nil || *infile == "" {
@@ -72,41 +148,29 @@ func main() {
 	json.Unmarshal(raw, &monitors)
 	if all {
 		for _, v := range monitors {
-			// timestamp succ err inprogress send recv sendSize recvSize lt_100 lt_200 lt_300 lt_400 lt_500 lt_600 lt_700 lt_800 lt_900 lt_1000 ge_1000
-			fmt.Printf("%s %d %d %d %d %d %d %d %d %d %d %d %d %d %d %d %d %d %d\n",
-				v.Timestamp, v.Counters.Established, v.Counters.Error, v.Counters.InProgress,
-				v.Counters.Send,
-				v.Counters.Recv,
-				v.Counters.SendSize,
-				v.Counters.RecvSize,
-				v.Counters.LT_100,
-				v.Counters.LT_200,
-				v.Counters.LT_300,
-				v.Counters.LT_400,
-				v.Counters.LT_500,
-				v.Counters.LT_600,
-				v.Counters.LT_700,
-				v.Counters.LT_800,
-				v.Counters.LT_900,
-				v.Counters.LT_1000,
-				v.Counters.GE_1000)
+			// timestamp succ err inprogress send recv sendSize recvSize <latency buckets>
+			fmt.Printf("%s %d %d %d %d %d %d %d",
+				v.Timestamp,
+				v.value("connection:established"),
+				v.value("connection:error"),
+				v.value("connection:inprogress"),
+				v.value("message:sent"),
+				v.value("message:received"),
+				v.value("message:sendSize"),
+				v.value("message:recvSize"))
+			for _, bucket := range v.latencyBuckets() {
+				fmt.Printf(" %d", v.value(bucket))
+			}
+			fmt.Println()
 		}
 	}
 	if lastLatency {
 		var v Monitor
 		v = monitors[len(monitors)-1]
 		fmt.Printf("['Latency category', 'Counters'],\n")
-		fmt.Printf("['LT100', %d],\n", v.Counters.LT_100)
-		fmt.Printf("['LT200', %d],\n", v.Counters.LT_200)
-		fmt.Printf("['LT300', %d],\n", v.Counters.LT_300)
-		fmt.Printf("['LT400', %d],\n", v.Counters.LT_400)
-		fmt.Printf("['LT500', %d],\n", v.Counters.LT_500)
-		fmt.Printf("['LT600', %d],\n", v.Counters.LT_600)
-		fmt.Printf("['LT700', %d],\n", v.Counters.LT_700)
-		fmt.Printf("['LT800', %d],\n", v.Counters.LT_800)
-		fmt.Printf("['LT900', %d],\n", v.Counters.LT_900)
-		fmt.Printf("['LT1000', %d],\n", v.Counters.LT_1000)
-		fmt.Printf("['GE1000', %d],\n", v.Counters.GE_1000)
+		for _, bucket := range v.latencyBuckets() {
+			fmt.Printf("['%s', %d],\n", latencyLabel(bucket), v.value(bucket))
+		}
 	}
 	if rate {
 		fmt.Printf("\tdata.addColumn('timeofday', 'Time');\n")
@@ -115,7 +179,7 @@ func main() {
 		fmt.Printf("\tdata.addRows([\n")
 		for i, j := 0, 1; j < len(monitors); i, j = i+1, j+1 {
 			t1, _ := time.Parse(time.RFC3339, monitors[j].Timestamp)
-			fmt.Printf("\t [[%d, %d, %d], %d, %d],\n", t1.Hour(), t1.Minute(), t1.Second(), monitors[j].Counters.Send - monitors[i].Counters.Send, monitors[j].Counters.Recv - monitors[i].Counters.Recv)
+			fmt.Printf("\t [[%d, %d, %d], %d, %d],\n", t1.Hour(), t1.Minute(), t1.Second(), monitors[j].value("message:sent")-monitors[i].value("message:sent"), monitors[j].value("message:received")-monitors[i].value("message:received"))
 		}
 		fmt.Printf("\t]);\n")
 	}
@@ -126,8 +190,18 @@ func main() {
 		fmt.Printf("\tdata.addRows([\n")
 		for i, j := 0, 1; j < len(monitors); i, j = i+1, j+1 {
 			t1, _ := time.Parse(time.RFC3339, monitors[j].Timestamp)
-			fmt.Printf("\t [[%d, %d, %d], %d, %d],\n", t1.Hour(), t1.Minute(), t1.Second(), monitors[j].Counters.SendSize - monitors[i].Counters.SendSize, monitors[j].Counters.RecvSize - monitors[i].Counters.RecvSize)
+			fmt.Printf("\t [[%d, %d, %d], %d, %d],\n", t1.Hour(), t1.Minute(), t1.Second(), monitors[j].value("message:sendSize")-monitors[i].value("message:sendSize"), monitors[j].value("message:recvSize")-monitors[i].value("message:recvSize"))
 		}
 		fmt.Printf("\t]);\n")
 	}
+	if rates {
+		for i, j := 0, 1; j < len(monitors); i, j = i+1, j+1 {
+			seconds := rateInterval(&monitors[i], &monitors[j])
+			fmt.Printf("%s", monitors[j].Timestamp)
+			for _, name := range monitors[j].counterNames() {
+				fmt.Printf(" %s=%.2f", name, float64(monitors[j].Counters[name]-monitors[i].Counters[name])/seconds)
+			}
+			fmt.Println()
+		}
+	}
 }
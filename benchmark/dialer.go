@@ -0,0 +1,159 @@
+package benchmark
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Latency series of the phases to build a connection, in the order they happen.
+const (
+	ConnectNegotiate = "connection:negotiate"
+	ConnectDial      = "connection:dial"
+	ConnectTls       = "connection:tls"
+	ConnectUpgrade   = "connection:upgrade"
+	ConnectHandshake = "connection:handshake"
+	ConnectReady     = "connection:ready"
+)
+
+// sourceAddrs chooses the local addresses of the outgoing connections round-robin, so that the connections
+// to one server endpoint are not limited by the ephemeral ports of a single address.
+type sourceAddrs struct {
+	addrs []*net.TCPAddr
+	next  uint64
+}
+
+// newSourceAddrs parses the local IPs, it returns nil if there is none and the system chooses the address.
+func newSourceAddrs(ips []string) (*sourceAddrs, error) {
+	if len(ips) == 0 {
+		return nil, nil
+	}
+	s := &sourceAddrs{addrs: make([]*net.TCPAddr, 0, len(ips))}
+	for _, ip := range ips {
+		addr := net.ParseIP(ip)
+		if addr == nil {
+			return nil, fmt.Errorf("Invalid source IP: %s", ip)
+		}
+		s.addrs = append(s.addrs, &net.TCPAddr{IP: addr})
+	}
+	return s, nil
+}
+
+func (s *sourceAddrs) pick() *net.TCPAddr {
+	if s == nil {
+		return nil
+	}
+	n := atomic.AddUint64(&s.next, 1)
+	return s.addrs[(n-1)%uint64(len(s.addrs))]
+}
+
+// dialTCP connects to the address from the next source address.
+// The connections are counted by source IP, and the port exhaustion errors are counted separately.
+func (w *WithCounter) dialTCP(addr string, source *sourceAddrs) (net.Conn, error) {
+	localAddr := source.pick()
+	dialer := &net.Dialer{}
+	if localAddr != nil {
+		dialer.LocalAddr = localAddr
+	}
+	conn, err := dialer.Dial("tcp", addr)
+	if err != nil {
+		if errors.Is(err, syscall.EADDRNOTAVAIL) {
+			w.Registry().Counter("connection:addr_not_avail").Add(1)
+		}
+		return nil, err
+	}
+	if localAddr != nil {
+		w.Registry().Counter("connection:source:" + localAddr.IP.String()).Add(1)
+	}
+	return conn, nil
+}
+
+// dialWebSocket connects to the websocket URL and records the latency of the TCP dial, TLS handshake
+// and websocket upgrade phases. tlsConfig is used for wss URLs, whose host is the default server name.
+// The connection is made from the next address of source if it is not nil.
+// The TLS handshake is done in NetDial rather than by the websocket dialer so that it can be timed separately,
+// thus wss connections are made directly without the proxy from environment.
+func (w *WithCounter) dialWebSocket(wsURL string, tlsConfig *tls.Config, source *sourceAddrs) (*websocket.Conn, error) {
+	u, err := url.Parse(wsURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var header http.Header
+	if u.Scheme == "wss" {
+		host, port, err := net.SplitHostPort(u.Host)
+		if err != nil {
+			host, port = u.Host, "443"
+		}
+		// keep the Host header of the original URL
+		header = http.Header{"Host": []string{u.Host}}
+		tlsConfig = clientTLSConfig(tlsConfig, host)
+		u.Scheme = "ws"
+		u.Host = net.JoinHostPort(host, port)
+	} else {
+		tlsConfig = nil
+	}
+
+	var dialDuration, tlsDuration time.Duration
+	dialer := &websocket.Dialer{
+		NetDial: func(network, addr string) (net.Conn, error) {
+			start := time.Now()
+			conn, err := w.dialTCP(addr, source)
+			dialDuration = time.Since(start)
+			if err != nil {
+				return nil, err
+			}
+
+			if e := conn.(*net.TCPConn).SetLinger(0); e != nil {
+				log.Println("Fail to set linger", e)
+			}
+
+			if tlsConfig == nil {
+				return conn, nil
+			}
+
+			start = time.Now()
+			tlsConn := tls.Client(conn, tlsConfig)
+			err = tlsConn.Handshake()
+			tlsDuration = time.Since(start)
+			if err != nil {
+				conn.Close()
+				return nil, err
+			}
+			return tlsConn, nil
+		},
+		HandshakeTimeout: 45 * time.Second,
+	}
+	if tlsConfig == nil {
+		dialer.Proxy = http.ProxyFromEnvironment
+	}
+
+	start := time.Now()
+	c, _, err := dialer.Dial(u.String(), header)
+	if err != nil {
+		return nil, err
+	}
+
+	w.LogDuration(ConnectDial, dialDuration)
+	if tlsConfig != nil {
+		w.LogDuration(ConnectTls, tlsDuration)
+	}
+	w.LogDuration(ConnectUpgrade, time.Since(start)-dialDuration-tlsDuration)
+	return c, nil
+}
+
+// newHTTPClient creates the client for the HTTP requests to the server, e.g. negotiate, with the TLS config for https.
+func newHTTPClient(tlsConfig *tls.Config) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Transport: transport}
+}
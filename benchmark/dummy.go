@@ -1,5 +1,9 @@
 package benchmark
 
+import (
+	"aspnet.com/util"
+)
+
 var _ Subject = (*Dummy)(nil)
 
 type Dummy struct {
@@ -9,11 +13,17 @@ func (s *Dummy) Setup(config *Config, p ProtocolProcessing) error {
 	return nil
 }
 
-func (s *Dummy) Counters() map[string]int64 {
-	return map[string]int64{
-		"counter1": 100,
-		"counter2": 50,
-	}
+func (s *Dummy) Counters() *util.MetricsSnapshot {
+	h := util.NewHistogram()
+	h.Record(10)
+	h.Record(20)
+
+	snapshot := util.NewMetricsSnapshot()
+	snapshot.Counters["counter1"] = 100
+	snapshot.Counters["counter2"] = 50
+	snapshot.Gauges["gauge1"] = 10
+	snapshot.Histograms["message"] = h
+	return snapshot
 }
 
 func (s *Dummy) LatencyCheckTarget() string {
@@ -56,6 +66,14 @@ func (s *Dummy) DoGroupSend(clients int, intervalMillis int) error {
 	return nil
 }
 
+func (s *Dummy) DoGroupSendRate(clients int, rate int) error {
+	return nil
+}
+
 func (s *Dummy) DoSend(clients int, intervalMillis int) error {
 	return nil
 }
+
+func (s *Dummy) DoSendRate(clients int, rate int) error {
+	return nil
+}
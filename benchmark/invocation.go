@@ -0,0 +1,98 @@
+package benchmark
+
+import (
+	"sync"
+	"time"
+
+	"aspnet.com/util"
+)
+
+// invocationSweepInterval is how often the invocations are checked for timeout.
+const invocationSweepInterval = time.Second
+
+// Completion result kinds of the MessagePack protocol.
+const (
+	completionError  = 1
+	completionVoid   = 2
+	completionResult = 3
+)
+
+type invocationKey struct {
+	session string
+	id      int64
+}
+
+// invocationTracker tracks the blocking invocations sent by the sessions of a subject until their
+// completions arrive or they time out.
+type invocationTracker struct {
+	lock    sync.Mutex
+	timeout time.Duration
+	pending map[invocationKey]time.Time
+	sweeper *wheelTimer
+}
+
+// newInvocationTracker starts to track the invocations, the ones not completed within timeout are
+// removed and counted as invocation:timeout to the registry.
+func newInvocationTracker(timeout time.Duration, registry *util.Registry) *invocationTracker {
+	t := &invocationTracker{
+		timeout: timeout,
+		pending: make(map[invocationKey]time.Time),
+	}
+	t.sweeper = sessionWheels.Schedule(invocationSweepInterval, invocationSweepInterval, func() {
+		t.sweep(util.Now(), registry)
+	})
+	return t
+}
+
+// sweep expires the invocations timed out by now and counts them to the registry.
+func (t *invocationTracker) sweep(now time.Time, registry *util.Registry) {
+	if expired := t.expire(now); expired > 0 {
+		registry.Counter("invocation:timeout").Add(expired)
+		registry.Gauge("invocation:outstanding").Add(-expired)
+	}
+}
+
+// Stop stops checking the timeout.
+func (t *invocationTracker) Stop() {
+	t.sweeper.Stop()
+}
+
+func (t *invocationTracker) start(session string, id int64, sendTime time.Time) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.pending[invocationKey{session, id}] = sendTime
+}
+
+// cancel removes the invocation which is not sent.
+func (t *invocationTracker) cancel(session string, id int64) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	delete(t.pending, invocationKey{session, id})
+}
+
+// complete removes the invocation and returns its send time, or false if it is unknown or timed out already.
+func (t *invocationTracker) complete(session string, id int64) (time.Time, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	key := invocationKey{session, id}
+	sendTime, ok := t.pending[key]
+	if ok {
+		delete(t.pending, key)
+	}
+	return sendTime, ok
+}
+
+// expire removes the invocations sent before now - timeout and returns the number of them.
+func (t *invocationTracker) expire(now time.Time) int64 {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	deadline := now.Add(-t.timeout)
+	var expired int64
+	for key, sendTime := range t.pending {
+		if sendTime.Before(deadline) {
+			delete(t.pending, key)
+			expired++
+		}
+	}
+	return expired
+}
@@ -0,0 +1,112 @@
+package benchmark
+
+import (
+	"testing"
+	"time"
+
+	"aspnet.com/util"
+)
+
+func TestInvocationTracker(t *testing.T) {
+	tracker := &invocationTracker{timeout: 10 * time.Second, pending: make(map[invocationKey]time.Time)}
+	now := time.Unix(1000, 0)
+	tracker.start("a", 1, now.Add(-11*time.Second))
+	tracker.start("a", 2, now.Add(-9*time.Second))
+	tracker.start("b", 1, now.Add(-time.Second))
+	tracker.start("b", 2, now)
+	tracker.cancel("b", 2)
+
+	if sendTime, ok := tracker.complete("b", 1); !ok || !sendTime.Equal(now.Add(-time.Second)) {
+		t.Errorf("complete b 1 = %v %v, want its send time", sendTime, ok)
+	}
+	if _, ok := tracker.complete("b", 1); ok {
+		t.Errorf("b 1 is completed twice")
+	}
+	if _, ok := tracker.complete("b", 2); ok {
+		t.Errorf("the cancelled b 2 is completed")
+	}
+	if expired := tracker.expire(now); expired != 1 {
+		t.Errorf("%d invocations expired, want 1", expired)
+	}
+	if _, ok := tracker.complete("a", 1); ok {
+		t.Errorf("the expired a 1 is completed")
+	}
+	if _, ok := tracker.complete("a", 2); !ok {
+		t.Errorf("a 2 is not completed")
+	}
+}
+
+func TestProcessCompletion(t *testing.T) {
+	s := &SignalrCoreCommon{}
+	s.registry = util.NewRegistry()
+	s.invocations = newInvocationTracker(10*time.Second, s.registry)
+	defer s.invocations.Stop()
+	s.streams = newStreamTracker(0, &s.WithCounter)
+	s.uploads = newUploadTracker(0, s.registry)
+
+	sendTime := util.Now()
+	for _, id := range []int64{1, 2} {
+		s.invocations.start("client", id, sendTime)
+		s.registry.Gauge("invocation:outstanding").Add(1)
+	}
+
+	cases := []struct {
+		invocationID string
+		errorText    string
+		counter      string
+	}{
+		{"1", "", "invocation:completed"},
+		{"2", "failed", "invocation:error"},
+		{"1", "", "invocation:unknown_completion"},
+		{"3", "", "invocation:unknown_completion"},
+		{"x", "", "invocation:unknown_completion"},
+	}
+	counts := make(map[string]int64)
+	for _, c := range cases {
+		s.processCompletion("client", c.invocationID, c.errorText)
+		counts[c.counter]++
+		for counter, want := range counts {
+			if got := s.registry.Counter(counter).Value(); got != want {
+				t.Errorf("completion %s: %d %s, want %d", c.invocationID, got, counter, want)
+			}
+		}
+	}
+	// the completions of the non-blocking invocations are not tracked
+	s.processCompletion("client", "", "")
+
+	snapshot := s.registry.Snapshot()
+	if outstanding := snapshot.Value("invocation:outstanding"); outstanding != 0 {
+		t.Errorf("%d invocations outstanding, want 0", outstanding)
+	}
+	if h, ok := snapshot.Histograms["invocation:completion"]; !ok || h.Count != 2 {
+		t.Errorf("invocation:completion %+v, want 2 completions", h)
+	}
+	if unknown := snapshot.Value("invocation:unknown_completion"); unknown != 3 {
+		t.Errorf("%d invocation:unknown_completion, want 3", unknown)
+	}
+}
+
+func TestInvocationTimeout(t *testing.T) {
+	registry := util.NewRegistry()
+	tracker := &invocationTracker{timeout: 10 * time.Second, pending: make(map[invocationKey]time.Time)}
+	now := time.Unix(1000, 0)
+	for id, age := range []time.Duration{time.Minute, 11 * time.Second, time.Second} {
+		tracker.start("client", int64(id), now.Add(-age))
+		registry.Gauge("invocation:outstanding").Add(1)
+	}
+
+	tracker.sweep(now, registry)
+	if timeout := registry.Counter("invocation:timeout").Value(); timeout != 2 {
+		t.Errorf("%d invocation:timeout, want 2", timeout)
+	}
+	if outstanding := registry.Gauge("invocation:outstanding").Value(); outstanding != 1 {
+		t.Errorf("%d invocations outstanding, want 1", outstanding)
+	}
+	tracker.sweep(now.Add(9*time.Second), registry)
+	if timeout := registry.Counter("invocation:timeout").Value(); timeout != 2 {
+		t.Errorf("%d invocation:timeout after the invocation in time, want 2", timeout)
+	}
+	if _, ok := tracker.complete("client", 2); !ok {
+		t.Errorf("the invocation in time is expired")
+	}
+}
@@ -0,0 +1,90 @@
+package benchmark
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// KeepAlivePolicy defines how a session keeps its connection alive and detects a silent server,
+// the same as the KeepAliveInterval and ServerTimeout of the SignalR clients.
+type KeepAlivePolicy struct {
+	// Interval is how long the session waits without sending anything before it sends a ping, 0 means no ping.
+	Interval time.Duration
+	// ServerTimeout is how long the session waits without receiving anything before it closes the connection
+	// as timed out, 0 means no timeout. It should be longer than the ping interval of the server.
+	ServerTimeout time.Duration
+}
+
+func (p *KeepAlivePolicy) enabled() bool {
+	return p.Interval > 0 || p.ServerTimeout > 0
+}
+
+var (
+	jsonPingMessage    = PlainMessage{websocket.TextMessage, []byte("{\"type\":6}\x1e")}
+	msgpackPingMessage = PlainMessage{websocket.BinaryMessage, []byte{0x02, 0x91, 0x06}}
+)
+
+// startKeepAlive starts the keep-alive and the watchdog of the session once its handshake completes.
+// They are stopped when the connection times out or the session is closed.
+func (s *Session) startKeepAlive() {
+	if !s.keepAlive.enabled() {
+		return
+	}
+	s.genLock.Lock()
+	defer s.genLock.Unlock()
+	if s.keepAliveTimer != nil || atomic.LoadInt32(&s.closing) == 1 {
+		return
+	}
+	// the timer checks 4 times within the interval, so that the ping or the timeout is late by a quarter at most
+	check := s.keepAlive.Interval
+	if check <= 0 || (s.keepAlive.ServerTimeout > 0 && s.keepAlive.ServerTimeout < check) {
+		check = s.keepAlive.ServerTimeout
+	}
+	check /= 4
+	if check < wheelTick {
+		check = wheelTick
+	}
+	s.keepAliveTimer = sessionWheels.Schedule(check, check, s.checkKeepAlive)
+}
+
+func (s *Session) stopKeepAlive() {
+	s.genLock.Lock()
+	defer s.genLock.Unlock()
+	if s.keepAliveTimer != nil {
+		s.keepAliveTimer.Stop()
+		s.keepAliveTimer = nil
+	}
+}
+
+// checkKeepAlive sends a ping if nothing is sent within the interval, and closes the connection if nothing
+// is received within the server timeout. It runs on the shared timer wheel so it must not block.
+func (s *Session) checkKeepAlive() {
+	if atomic.LoadInt32(&s.dropped) == 1 || atomic.LoadInt32(&s.closing) == 1 {
+		return
+	}
+	now := time.Now().UnixNano()
+	if timeout := s.keepAlive.ServerTimeout; timeout > 0 && now-atomic.LoadInt64(&s.lastReceived) > int64(timeout) {
+		s.counter.Registry().Counter("connection:server_timeout").Add(1)
+		// the read fails then, and the connection is rebuilt following the reconnect policy,
+		// whose handshake starts the keep-alive again
+		s.stopKeepAlive()
+		s.conn().Close()
+		return
+	}
+	if interval := s.keepAlive.Interval; interval > 0 && now-atomic.LoadInt64(&s.lastSent) > int64(interval) {
+		msg := Message(jsonPingMessage)
+		if s.protocol == "messagepack" {
+			msg = msgpackPingMessage
+		}
+		select {
+		case s.Sending <- msg:
+			// it is counted as sent when queued, so that a slow connection is not pinged again meanwhile
+			atomic.StoreInt64(&s.lastSent, now)
+			s.counter.Registry().Counter("ping:sent").Add(1)
+		default:
+			// a message is waiting to be sent anyway
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package benchmark
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// longPollingCloseTimeout is how long to wait for the DELETE request closing a long polling connection.
+const longPollingCloseTimeout = 5 * time.Second
+
+// longPollingTransport receives the frames with the poll requests (GET), each of which is answered when there
+// are messages or the poll times out on the server, and sends the frames with POST requests. The connection
+// is closed with a DELETE request, or by the server answering a poll with 204.
+type longPollingTransport struct {
+	client      *http.Client
+	url         string
+	accessToken string
+	// messageType is TextMessage for JSON, or BinaryMessage for MessagePack.
+	messageType int
+	ctx         context.Context
+	cancel      context.CancelFunc
+	closeOnce   sync.Once
+}
+
+var _ Transport = (*longPollingTransport)(nil)
+
+func newLongPollingTransport(client *http.Client, url string, accessToken string, messageType int) *longPollingTransport {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &longPollingTransport{
+		client:      client,
+		url:         url,
+		accessToken: accessToken,
+		messageType: messageType,
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+}
+
+// ReadMessage polls until a poll returns messages. A frame may contain several messages.
+func (t *longPollingTransport) ReadMessage() (int, []byte, error) {
+	for {
+		request, err := newTransportRequest(t.ctx, http.MethodGet, t.url, t.accessToken, nil)
+		if err != nil {
+			return 0, nil, err
+		}
+		response, err := t.client.Do(request)
+		if err != nil {
+			if t.ctx.Err() != nil {
+				return 0, nil, errTransportClosed
+			}
+			return 0, nil, err
+		}
+		data, err := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		switch {
+		case response.StatusCode == http.StatusNoContent:
+			return 0, nil, errTransportClosed
+		case response.StatusCode != http.StatusOK:
+			return 0, nil, fmt.Errorf("Poll failed: %s", response.Status)
+		case err != nil:
+			return 0, nil, err
+		case len(data) > 0:
+			return t.messageType, data, nil
+		}
+		// the poll timed out
+	}
+}
+
+func (t *longPollingTransport) WriteMessage(messageType int, data []byte) error {
+	if messageType == websocket.CloseMessage {
+		return t.Close()
+	}
+	return postMessage(t.ctx, t.client, t.url, t.accessToken, data)
+}
+
+// Close stops the poll and deletes the connection on the server.
+func (t *longPollingTransport) Close() error {
+	var err error
+	t.closeOnce.Do(func() {
+		t.cancel()
+		ctx, cancel := context.WithTimeout(context.Background(), longPollingCloseTimeout)
+		defer cancel()
+		request, e := newTransportRequest(ctx, http.MethodDelete, t.url, t.accessToken, nil)
+		if e != nil {
+			err = e
+			return
+		}
+		response, e := t.client.Do(request)
+		if e != nil {
+			err = e
+			return
+		}
+		response.Body.Close()
+		t.client.CloseIdleConnections()
+	})
+	return err
+}
+
+// SignalrLongPollingConnect connects to the SignalR core server with the long polling transport.
+func (s *SignalrCoreCommon) SignalrLongPollingConnect(protocol string) (*Session, error) {
+	return s.baseConnect(protocol, s.negotiateDial(protocol, TransportLongPolling))
+}
@@ -0,0 +1,159 @@
+package benchmark
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// pollServer answers the polls with its responses in order, an empty body being a timed out poll. The polls after
+// the last response wait until they are cancelled. The bodies posted and the DELETE requests are recorded.
+type pollServer struct {
+	lock      sync.Mutex
+	responses []int
+	bodies    []string
+	polls     int
+	posted    []string
+	deletes   int
+	errors    []string
+}
+
+func (s *pollServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	if auth := r.Header.Get("Authorization"); auth != "Bearer token" {
+		s.errors = append(s.errors, r.Method+" with authorization "+auth)
+	}
+	switch r.Method {
+	case http.MethodGet:
+		if s.polls >= len(s.responses) {
+			s.polls++
+			s.lock.Unlock()
+			<-r.Context().Done()
+			return
+		}
+		status, body := s.responses[s.polls], s.bodies[s.polls]
+		s.polls++
+		s.lock.Unlock()
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+		return
+	case http.MethodPost:
+		data, _ := ioutil.ReadAll(r.Body)
+		s.posted = append(s.posted, string(data))
+	case http.MethodDelete:
+		s.deletes++
+	}
+	s.lock.Unlock()
+}
+
+func (s *pollServer) respond(status int, body string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.responses = append(s.responses, status)
+	s.bodies = append(s.bodies, body)
+}
+
+func (s *pollServer) counts() (int, int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.polls, s.deletes
+}
+
+func TestLongPollingTransport(t *testing.T) {
+	poll := &pollServer{}
+	server := httptest.NewServer(poll)
+	defer server.Close()
+	poll.respond(http.StatusOK, "")
+	poll.respond(http.StatusOK, "frame")
+	poll.respond(http.StatusOK, "")
+	poll.respond(http.StatusNoContent, "")
+
+	transport := newLongPollingTransport(server.Client(), server.URL, "token", websocket.BinaryMessage)
+	// the empty poll is polled again
+	messageType, data, err := transport.ReadMessage()
+	if err != nil || messageType != websocket.BinaryMessage || string(data) != "frame" {
+		t.Fatalf("ReadMessage() = %d %q %v, want the frame", messageType, data, err)
+	}
+	if polls, _ := poll.counts(); polls != 2 {
+		t.Errorf("%d polls for the frame, want 2", polls)
+	}
+	if err := transport.WriteMessage(websocket.BinaryMessage, []byte("sent")); err != nil {
+		t.Errorf("WriteMessage() failed: %v", err)
+	}
+	// 204 closes the connection
+	if _, _, err := transport.ReadMessage(); err != errTransportClosed {
+		t.Errorf("ReadMessage() after 204 = %v, want %v", err, errTransportClosed)
+	}
+	if polls, _ := poll.counts(); polls != 4 {
+		t.Errorf("%d polls until 204, want 4", polls)
+	}
+
+	// Close sends a single DELETE, also when it is closed by the close message
+	if err := transport.WriteMessage(websocket.CloseMessage, nil); err != nil {
+		t.Errorf("WriteMessage(CloseMessage) failed: %v", err)
+	}
+	if err := transport.Close(); err != nil {
+		t.Errorf("Close() failed: %v", err)
+	}
+	if _, deletes := poll.counts(); deletes != 1 {
+		t.Errorf("%d DELETE requests, want 1", deletes)
+	}
+	poll.lock.Lock()
+	defer poll.lock.Unlock()
+	if len(poll.posted) != 1 || poll.posted[0] != "sent" {
+		t.Errorf("posted %q, want the sent frame", poll.posted)
+	}
+	for _, e := range poll.errors {
+		t.Error(e)
+	}
+}
+
+func TestLongPollingTransportPollFailed(t *testing.T) {
+	poll := &pollServer{}
+	server := httptest.NewServer(poll)
+	defer server.Close()
+	poll.respond(http.StatusNotFound, "")
+
+	transport := newLongPollingTransport(server.Client(), server.URL, "token", websocket.TextMessage)
+	defer transport.Close()
+	if _, _, err := transport.ReadMessage(); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("ReadMessage() of 404 = %v, want a failed poll", err)
+	}
+}
+
+func TestLongPollingTransportClose(t *testing.T) {
+	poll := &pollServer{}
+	server := httptest.NewServer(poll)
+	defer server.Close()
+
+	transport := newLongPollingTransport(server.Client(), server.URL, "token", websocket.TextMessage)
+	read := make(chan error)
+	go func() {
+		_, _, err := transport.ReadMessage()
+		read <- err
+	}()
+	for polls, _ := poll.counts(); polls == 0; polls, _ = poll.counts() {
+		time.Sleep(time.Millisecond)
+	}
+	// Close stops the outstanding poll and deletes the connection
+	if err := transport.Close(); err != nil {
+		t.Errorf("Close() failed: %v", err)
+	}
+	select {
+	case err := <-read:
+		if err != errTransportClosed {
+			t.Errorf("ReadMessage() after Close() = %v, want %v", err, errTransportClosed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the poll is not stopped by Close()")
+	}
+	if _, deletes := poll.counts(); deletes != 1 {
+		t.Errorf("%d DELETE requests, want 1", deletes)
+	}
+}
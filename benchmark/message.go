@@ -42,5 +42,7 @@ func (c CloseMessage) Bytes() []byte {
 
 type MessageGenerator interface {
 	Interval() time.Duration
-	Generate(uid string, groupName string, invocationId int64) Message
+	// Generate creates the next message of the session to be sent at sendTime, which is the time of the reference
+	// clock that the latency is measured from. The message carries the sequence number and the payload of the session.
+	Generate(session *Session, sendTime time.Time) Message
 }
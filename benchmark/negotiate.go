@@ -0,0 +1,225 @@
+package benchmark
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Transports in the negotiate response of the ASP.NET Core SignalR server.
+const (
+	TransportWebSockets       = "WebSockets"
+	TransportServerSentEvents = "ServerSentEvents"
+	TransportLongPolling      = "LongPolling"
+)
+
+// maxNegotiateRedirects is the number of redirects followed by negotiate, the same as the SignalR clients.
+const maxNegotiateRedirects = 100
+
+// Outcomes of a negotiate request, which are counted as "negotiate:<outcome>" and timed as "negotiate:<outcome>:time".
+const (
+	negotiateSuccess     = "success"
+	negotiateRedirect    = "redirect"
+	negotiateError       = "error"
+	negotiateFailed      = "failed"
+	negotiateNoTransport = "no_transport"
+)
+
+// SignalRCoreTransport is a transport in the negotiate response of the ASP.NET Core SignalR server.
+type SignalRCoreTransport struct {
+	Transport       string   `json:"transport"`
+	TransferFormats []string `json:"transferFormats"`
+}
+
+// SignalRCoreNegotiateResponse is the negotiate response of the ASP.NET Core SignalR server. It either redirects
+// the client to Url with AccessToken, e.g. to SignalR Service, fails with Error, or describes the connection.
+type SignalRCoreNegotiateResponse struct {
+	NegotiateVersion int    `json:"negotiateVersion"`
+	ConnectionId     string `json:"connectionId"`
+	// ConnectionToken identifies the connection in the requests of the transports since negotiate version 1.
+	ConnectionToken     string                 `json:"connectionToken"`
+	AvailableTransports []SignalRCoreTransport `json:"availableTransports"`
+	Url                 string                 `json:"url"`
+	AccessToken         string                 `json:"accessToken"`
+	Error               string                 `json:"error"`
+}
+
+// negotiatedConnection is where and how to connect after negotiate.
+type negotiatedConnection struct {
+	// url is the HTTP URL of the connection, with its ID.
+	url         string
+	transport   string
+	accessToken string
+}
+
+// transferFormat is the transfer format the protocol needs from the transport.
+func transferFormat(protocol string) string {
+	if protocol == "messagepack" {
+		return "Binary"
+	}
+	return "Text"
+}
+
+// selectTransport returns the first of the transports which is available with the transfer format, or else empty.
+func selectTransport(available []SignalRCoreTransport, transports []string, format string) string {
+	for _, transport := range transports {
+		for _, a := range available {
+			if a.Transport != transport {
+				continue
+			}
+			for _, f := range a.TransferFormats {
+				if f == format {
+					return transport
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// negotiate negotiates with the SignalR core server following the redirects, and selects the first of the transports
+// available for the protocol. The error is logged and counted to errorGroup.
+func (s *SignalrCoreCommon) negotiate(id string, errorGroup string, protocol string, transports []string) (*negotiatedConnection, error) {
+	start := time.Now()
+	baseURL := s.httpURL("")
+	accessToken := ""
+	for redirects := 0; redirects <= maxNegotiateRedirects; redirects++ {
+		requestStart := time.Now()
+		response, err := s.negotiateRequest(baseURL, accessToken)
+		if err != nil {
+			s.negotiateOutcome(negotiateFailed, requestStart)
+			s.LogError(errorGroup, id, "Failed to negotiate with the server", err)
+			return nil, err
+		}
+		if response.Error != "" {
+			s.negotiateOutcome(negotiateError, requestStart)
+			err = errors.New(response.Error)
+			s.LogError(errorGroup, id, "Negotiate is rejected by the server", err)
+			return nil, err
+		}
+		if response.Url != "" {
+			s.negotiateOutcome(negotiateRedirect, requestStart)
+			baseURL = response.Url
+			accessToken = response.AccessToken
+			continue
+		}
+
+		transport := selectTransport(response.AvailableTransports, transports, transferFormat(protocol))
+		if transport == "" {
+			s.negotiateOutcome(negotiateNoTransport, requestStart)
+			err = fmt.Errorf("None of %s is available for %s", strings.Join(transports, ", "), protocol)
+			s.LogError(errorGroup, id, "Failed to negotiate with the server", err)
+			return nil, err
+		}
+		s.negotiateOutcome(negotiateSuccess, requestStart)
+		s.LogDuration(ConnectNegotiate, time.Since(start))
+
+		connectionID := response.ConnectionId
+		if response.NegotiateVersion >= 1 && response.ConnectionToken != "" {
+			connectionID = response.ConnectionToken
+		}
+		connectionURL, err := url.Parse(baseURL)
+		if err != nil {
+			s.LogError(errorGroup, id, "Failed to parse the connection URL", err)
+			return nil, err
+		}
+		query := connectionURL.Query()
+		query.Set("id", connectionID)
+		connectionURL.RawQuery = query.Encode()
+		return &negotiatedConnection{
+			url:         connectionURL.String(),
+			transport:   transport,
+			accessToken: accessToken,
+		}, nil
+	}
+
+	s.registry.Counter("negotiate:too_many_redirects").Add(1)
+	err := fmt.Errorf("More than %d redirects", maxNegotiateRedirects)
+	s.LogError(errorGroup, id, "Failed to negotiate with the server", err)
+	return nil, err
+}
+
+func (s *SignalrCoreCommon) negotiateOutcome(outcome string, start time.Time) {
+	s.registry.Counter("negotiate:" + outcome).Add(1)
+	s.LogDuration("negotiate:"+outcome+":time", time.Since(start))
+}
+
+// negotiateRequest posts the negotiate request of the connection at baseURL.
+func (s *SignalrCoreCommon) negotiateRequest(baseURL string, accessToken string) (*SignalRCoreNegotiateResponse, error) {
+	negotiateURL, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	negotiateURL.Path = strings.TrimSuffix(negotiateURL.Path, "/") + "/negotiate"
+	if s.negotiateVersion > 0 {
+		query := negotiateURL.Query()
+		query.Set("negotiateVersion", strconv.Itoa(s.negotiateVersion))
+		negotiateURL.RawQuery = query.Encode()
+	}
+	request, err := http.NewRequest(http.MethodPost, negotiateURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if accessToken != "" {
+		request.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	response, err := s.httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Negotiate failed: %s", response.Status)
+	}
+	negotiate := &SignalRCoreNegotiateResponse{}
+	if err = json.NewDecoder(response.Body).Decode(negotiate); err != nil {
+		return nil, err
+	}
+	return negotiate, nil
+}
+
+// negotiateDial returns the dial of baseConnect, which negotiates with the server and connects with the first
+// of the transports available for the protocol.
+func (s *SignalrCoreCommon) negotiateDial(protocol string, transports ...string) func(id string, errorGroup string) (Transport, error) {
+	return func(id string, errorGroup string) (Transport, error) {
+		connection, err := s.negotiate(id, errorGroup, protocol, transports)
+		if err != nil {
+			return nil, err
+		}
+		s.registry.Counter("connection:transport:" + connection.transport).Add(1)
+		switch connection.transport {
+		case TransportLongPolling:
+			messageType := websocket.TextMessage
+			if protocol == "messagepack" {
+				messageType = websocket.BinaryMessage
+			}
+			return newLongPollingTransport(s.newSessionHTTPClient(), connection.url, connection.accessToken, messageType), nil
+		case TransportServerSentEvents:
+			t := newSSETransport(s.newSessionHTTPClient(), connection.url, connection.accessToken, &s.WithCounter)
+			if err = t.connect(); err != nil {
+				t.Close()
+				s.LogError(errorGroup, id, "Failed to connect to the event stream", err)
+				return nil, err
+			}
+			return t, nil
+		default:
+			wsURL := "ws" + strings.TrimPrefix(connection.url, "http")
+			if connection.accessToken != "" {
+				wsURL += "&access_token=" + url.QueryEscape(connection.accessToken)
+			}
+			c, err := s.dialWebSocket(wsURL, s.tlsConfig, s.sourceAddrs)
+			if err != nil {
+				s.LogError(errorGroup, id, "Failed to connect to websocket", err)
+				return nil, err
+			}
+			return c, nil
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package benchmark
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"aspnet.com/util"
+)
+
+// negotiateServer serves the negotiate requests of the hubs at /redirect (to /hub with an access token), /hub
+// (negotiate version 1 if it is asked), /longpolling (text only), /loop (to itself) and /error.
+func negotiateServer(t *testing.T) *httptest.Server {
+	var server *httptest.Server
+	mux := http.NewServeMux()
+	respond := func(w http.ResponseWriter, body string) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, body)
+	}
+	mux.HandleFunc("/redirect/negotiate", func(w http.ResponseWriter, r *http.Request) {
+		respond(w, `{"url":"`+server.URL+`/hub","accessToken":"token"}`)
+	})
+	mux.HandleFunc("/hub/negotiate", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("negotiate with %s, want POST", r.Method)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		transports := `[{"transport":"WebSockets","transferFormats":["Text","Binary"]},` +
+			`{"transport":"ServerSentEvents","transferFormats":["Text"]}]`
+		if r.URL.Query().Get("negotiateVersion") == "1" {
+			respond(w, `{"negotiateVersion":1,"connectionId":"id","connectionToken":"token1","availableTransports":`+transports+`}`)
+		} else {
+			respond(w, `{"connectionId":"id0","availableTransports":`+transports+`}`)
+		}
+	})
+	mux.HandleFunc("/longpolling/negotiate", func(w http.ResponseWriter, r *http.Request) {
+		respond(w, `{"connectionId":"id","availableTransports":[{"transport":"LongPolling","transferFormats":["Text"]}]}`)
+	})
+	mux.HandleFunc("/loop/negotiate", func(w http.ResponseWriter, r *http.Request) {
+		respond(w, `{"url":"`+server.URL+`/loop"}`)
+	})
+	mux.HandleFunc("/error/negotiate", func(w http.ResponseWriter, r *http.Request) {
+		respond(w, `{"error":"rejected"}`)
+	})
+	server = httptest.NewServer(mux)
+	return server
+}
+
+func newNegotiateSubject(server *httptest.Server, path string, negotiateVersion int) *SignalrCoreCommon {
+	s := &SignalrCoreCommon{negotiateVersion: negotiateVersion}
+	s.host = strings.TrimPrefix(server.URL, "http://") + path
+	s.httpClient = server.Client()
+	s.registry = util.NewRegistry()
+	return s
+}
+
+func TestNegotiate(t *testing.T) {
+	server := negotiateServer(t)
+	defer server.Close()
+
+	cases := []struct {
+		name             string
+		path             string
+		negotiateVersion int
+		protocol         string
+		transports       []string
+		url              string
+		transport        string
+		accessToken      string
+		outcomes         map[string]int64
+	}{
+		{
+			"redirect with access token", "/redirect", 1, "json", []string{TransportWebSockets},
+			server.URL + "/hub?id=token1", TransportWebSockets, "token",
+			map[string]int64{"negotiate:redirect": 1, "negotiate:success": 1},
+		},
+		{
+			"connection id of version 0", "/redirect", 0, "messagepack", []string{TransportWebSockets},
+			server.URL + "/hub?id=id0", TransportWebSockets, "token",
+			map[string]int64{"negotiate:redirect": 1, "negotiate:success": 1},
+		},
+		{
+			"transport by transfer format", "/redirect", 1, "json", []string{TransportLongPolling, TransportServerSentEvents},
+			server.URL + "/hub?id=token1", TransportServerSentEvents, "token",
+			map[string]int64{"negotiate:redirect": 1, "negotiate:success": 1},
+		},
+		{
+			"no transport", "/longpolling", 1, "messagepack", []string{TransportWebSockets, TransportLongPolling},
+			"", "", "",
+			map[string]int64{"negotiate:no_transport": 1, "negotiate:success": 0},
+		},
+		{
+			"too many redirects", "/loop", 1, "json", []string{TransportWebSockets},
+			"", "", "",
+			map[string]int64{"negotiate:redirect": maxNegotiateRedirects + 1, "negotiate:too_many_redirects": 1},
+		},
+		{
+			"error", "/error", 1, "json", []string{TransportWebSockets},
+			"", "", "",
+			map[string]int64{"negotiate:error": 1},
+		},
+		{
+			"failed", "/missing", 1, "json", []string{TransportWebSockets},
+			"", "", "",
+			map[string]int64{"negotiate:failed": 1},
+		},
+	}
+	for _, c := range cases {
+		s := newNegotiateSubject(server, c.path, c.negotiateVersion)
+		connection, err := s.negotiate("client", "connection:error", c.protocol, c.transports)
+		if c.url == "" {
+			if err == nil {
+				t.Errorf("%s: negotiated %+v, want an error", c.name, connection)
+			}
+			if errors := s.registry.Counter("connection:error").Value(); errors != 1 {
+				t.Errorf("%s: %d connection:error, want 1", c.name, errors)
+			}
+		} else if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+		} else if connection.url != c.url || connection.transport != c.transport || connection.accessToken != c.accessToken {
+			t.Errorf("%s: negotiated %+v, want url %s transport %s accessToken %s",
+				c.name, connection, c.url, c.transport, c.accessToken)
+		}
+		snapshot := s.registry.Snapshot()
+		for outcome, want := range c.outcomes {
+			if got := snapshot.Value(outcome); got != want {
+				t.Errorf("%s: %d %s, want %d", c.name, got, outcome, want)
+			}
+			if outcome == "negotiate:too_many_redirects" {
+				// not a request of its own
+				continue
+			}
+			var timed int64
+			if histogram, ok := snapshot.Histograms[outcome+":time"]; ok {
+				timed = histogram.Count
+			}
+			if timed != want {
+				t.Errorf("%s: %s timed %d times, want %d", c.name, outcome, timed, want)
+			}
+		}
+	}
+}
+
+func TestSelectTransport(t *testing.T) {
+	available := []SignalRCoreTransport{
+		{TransportWebSockets, []string{"Text", "Binary"}},
+		{TransportServerSentEvents, []string{"Text"}},
+		{TransportLongPolling, []string{"Text", "Binary"}},
+	}
+	cases := []struct {
+		transports []string
+		format     string
+		want       string
+	}{
+		{[]string{TransportWebSockets, TransportLongPolling}, "Binary", TransportWebSockets},
+		{[]string{TransportServerSentEvents, TransportLongPolling}, "Binary", TransportLongPolling},
+		{[]string{TransportServerSentEvents, TransportLongPolling}, "Text", TransportServerSentEvents},
+		{[]string{TransportServerSentEvents}, "Binary", ""},
+		{[]string{"Unknown"}, "Text", ""},
+	}
+	for _, c := range cases {
+		if got := selectTransport(available, c.transports, c.format); got != c.want {
+			t.Errorf("selectTransport(%v, %s) = %q, want %q", c.transports, c.format, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package benchmark
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Distributions of the payload sizes.
+const (
+	PayloadFixed   = "fixed"
+	PayloadUniform = "uniform"
+	PayloadNormal  = "normal"
+	PayloadBuckets = "buckets"
+	PayloadCorpus  = "corpus"
+)
+
+// PayloadBucket is a payload size with its weight.
+type PayloadBucket struct {
+	Size   int
+	Weight float64
+}
+
+// PayloadConfig defines the payload carried by each message, whose size follows the distribution,
+// or which is picked from the corpus. There is no payload if Distribution is empty.
+type PayloadConfig struct {
+	Distribution string
+	// Size is the size of PayloadFixed.
+	Size int
+	// Min and Max are the inclusive range of PayloadUniform.
+	Min int
+	Max int
+	// Mean and StdDev are the parameters of PayloadNormal.
+	Mean   float64
+	StdDev float64
+	// Buckets are the sizes of PayloadBuckets chosen by their weights.
+	Buckets []PayloadBucket
+	// Corpus are the messages PayloadCorpus picks from randomly.
+	Corpus [][]byte
+}
+
+// ParsePayloadConfig parses the payload spec, which is one of
+//
+//	fixed:<size>
+//	uniform:<min>-<max>
+//	normal:<mean>,<stddev>
+//	buckets:<file> with a "<size> <weight>" per line
+//	corpus:<file> with a message per line, the lines starting with "base64:" are decoded as binary messages
+//
+// The files are read here so that the agents do not need them.
+func ParsePayloadConfig(spec string) (PayloadConfig, error) {
+	var config PayloadConfig
+	if spec == "" {
+		return config, nil
+	}
+	parts := strings.SplitN(spec, ":", 2)
+	if len(parts) != 2 {
+		return config, fmt.Errorf("Invalid payload: %s", spec)
+	}
+	config.Distribution = parts[0]
+	var err error
+	switch parts[0] {
+	case PayloadFixed:
+		config.Size, err = strconv.Atoi(parts[1])
+	case PayloadUniform:
+		bounds := strings.SplitN(parts[1], "-", 2)
+		if len(bounds) != 2 {
+			return config, fmt.Errorf("Invalid uniform payload: %s", spec)
+		}
+		if config.Min, err = strconv.Atoi(bounds[0]); err == nil {
+			config.Max, err = strconv.Atoi(bounds[1])
+		}
+	case PayloadNormal:
+		params := strings.SplitN(parts[1], ",", 2)
+		if len(params) != 2 {
+			return config, fmt.Errorf("Invalid normal payload: %s", spec)
+		}
+		if config.Mean, err = strconv.ParseFloat(params[0], 64); err == nil {
+			config.StdDev, err = strconv.ParseFloat(params[1], 64)
+		}
+	case PayloadBuckets:
+		config.Buckets, err = readPayloadBuckets(parts[1])
+	case PayloadCorpus:
+		config.Corpus, err = readPayloadCorpus(parts[1])
+	default:
+		return config, fmt.Errorf("Unknown payload distribution: %s", parts[0])
+	}
+	if err != nil {
+		return config, fmt.Errorf("Invalid payload %s: %v", spec, err)
+	}
+	_, err = newPayloadSource(config)
+	return config, err
+}
+
+func readPayloadBuckets(path string) ([]PayloadBucket, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	buckets := []PayloadBucket{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("Invalid bucket: %s", line)
+		}
+		size, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		weight, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, PayloadBucket{size, weight})
+	}
+	return buckets, scanner.Err()
+}
+
+func readPayloadCorpus(path string) ([][]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	corpus := [][]byte{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "base64:") {
+			data, err := base64.StdEncoding.DecodeString(line[len("base64:"):])
+			if err != nil {
+				return nil, err
+			}
+			corpus = append(corpus, data)
+		} else {
+			corpus = append(corpus, []byte(line))
+		}
+	}
+	return corpus, scanner.Err()
+}
+
+// payloadSource generates the payloads of the messages following the config.
+type payloadSource struct {
+	config      PayloadConfig
+	totalWeight float64
+}
+
+// newPayloadSource validates the config, it returns nil if there is no payload.
+func newPayloadSource(config PayloadConfig) (*payloadSource, error) {
+	p := &payloadSource{config: config}
+	switch config.Distribution {
+	case "":
+		return nil, nil
+	case PayloadFixed:
+		if config.Size < 0 {
+			return nil, fmt.Errorf("Payload size is negative")
+		}
+	case PayloadUniform:
+		if config.Min < 0 || config.Max < config.Min {
+			return nil, fmt.Errorf("Invalid payload range [%d, %d]", config.Min, config.Max)
+		}
+	case PayloadNormal:
+		if config.StdDev < 0 {
+			return nil, fmt.Errorf("Payload stddev is negative")
+		}
+	case PayloadBuckets:
+		for _, b := range config.Buckets {
+			if b.Size < 0 || b.Weight < 0 {
+				return nil, fmt.Errorf("Invalid payload bucket %d %f", b.Size, b.Weight)
+			}
+			p.totalWeight += b.Weight
+		}
+		if p.totalWeight <= 0 {
+			return nil, fmt.Errorf("No payload bucket with weight")
+		}
+	case PayloadCorpus:
+		if len(config.Corpus) == 0 {
+			return nil, fmt.Errorf("Payload corpus is empty")
+		}
+	default:
+		return nil, fmt.Errorf("Unknown payload distribution: %s", config.Distribution)
+	}
+	return p, nil
+}
+
+// Next returns the payload of the next message.
+func (p *payloadSource) Next() string {
+	if p == nil {
+		return ""
+	}
+	if p.config.Distribution == PayloadCorpus {
+		return string(p.config.Corpus[rand.Intn(len(p.config.Corpus))])
+	}
+	return RandStringBytesMaskImprSrc(p.size())
+}
+
+func (p *payloadSource) size() int {
+	switch p.config.Distribution {
+	case PayloadUniform:
+		return p.config.Min + rand.Intn(p.config.Max-p.config.Min+1)
+	case PayloadNormal:
+		size := math.Round(rand.NormFloat64()*p.config.StdDev + p.config.Mean)
+		if size < 0 {
+			return 0
+		}
+		return int(size)
+	case PayloadBuckets:
+		r := rand.Float64() * p.totalWeight
+		for _, b := range p.config.Buckets {
+			if r < b.Weight {
+				return b.Size
+			}
+			r -= b.Weight
+		}
+		return p.config.Buckets[len(p.config.Buckets)-1].Size
+	default:
+		return p.config.Size
+	}
+}
+
+// payloadArgument is the payload as an argument of its own, with the type the server handles for such a message:
+// a JSON payload is sent as JSON rather than a string with the JSON protocol, and a binary payload as bin with
+// MessagePack, or base64 with JSON. It is nil if there is no payload.
+func payloadArgument(payload string, jsonProtocol bool) interface{} {
+	switch {
+	case payload == "":
+		return nil
+	case jsonProtocol && json.Valid([]byte(payload)):
+		return json.RawMessage(payload)
+	case jsonProtocol:
+		return textPayload(payload)
+	case utf8.ValidString(payload):
+		return payload
+	default:
+		return []byte(payload)
+	}
+}
+
+// textPayload encodes the binary payload in base64 for the text protocols, which would replace
+// the invalid UTF-8 bytes otherwise.
+func textPayload(payload string) string {
+	if utf8.ValidString(payload) {
+		return payload
+	}
+	return base64.StdEncoding.EncodeToString([]byte(payload))
+}
@@ -0,0 +1,173 @@
+package benchmark
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePayloadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "payload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"buckets":         "# size weight\n10 1\n\n20 3\n",
+		"no_weight":       "10 0\n",
+		"bad_bucket":      "10\n",
+		"corpus":          "hello\n\nbase64:AAE=\n",
+		"empty_corpus":    "\n",
+		"bad_base64":      "base64:!\n",
+		"negative_size":   "-1 1\n",
+		"bad_bucket_size": "x 1\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	file := func(name string) string {
+		return filepath.Join(dir, name)
+	}
+
+	cases := []struct {
+		spec string
+		want PayloadConfig
+	}{
+		{"", PayloadConfig{}},
+		{"fixed:10", PayloadConfig{Distribution: PayloadFixed, Size: 10}},
+		{"uniform:5-9", PayloadConfig{Distribution: PayloadUniform, Min: 5, Max: 9}},
+		{"normal:100,12.5", PayloadConfig{Distribution: PayloadNormal, Mean: 100, StdDev: 12.5}},
+		{
+			"buckets:" + file("buckets"),
+			PayloadConfig{Distribution: PayloadBuckets, Buckets: []PayloadBucket{{10, 1}, {20, 3}}},
+		},
+		{
+			"corpus:" + file("corpus"),
+			PayloadConfig{Distribution: PayloadCorpus, Corpus: [][]byte{[]byte("hello"), {0, 1}}},
+		},
+	}
+	for _, c := range cases {
+		got, err := ParsePayloadConfig(c.spec)
+		if err != nil {
+			t.Errorf("ParsePayloadConfig(%q) failed: %v", c.spec, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("ParsePayloadConfig(%q) = %+v, want %+v", c.spec, got, c.want)
+		}
+	}
+
+	errors := []struct {
+		spec string
+		err  string
+	}{
+		{"fixed", "Invalid payload"},
+		{"fixed:x", "Invalid payload"},
+		{"fixed:-1", "negative"},
+		{"uniform:5", "Invalid uniform payload"},
+		{"uniform:9-5", "Invalid payload range"},
+		{"normal:1", "Invalid normal payload"},
+		{"normal:1,-2", "negative"},
+		{"gaussian:1", "Unknown payload distribution"},
+		{"buckets:" + file("missing"), "Invalid payload"},
+		{"buckets:" + file("no_weight"), "No payload bucket with weight"},
+		{"buckets:" + file("bad_bucket"), "Invalid bucket"},
+		{"buckets:" + file("negative_size"), "Invalid payload bucket"},
+		{"buckets:" + file("bad_bucket_size"), "Invalid payload"},
+		{"corpus:" + file("empty_corpus"), "Payload corpus is empty"},
+		{"corpus:" + file("bad_base64"), "Invalid payload"},
+	}
+	for _, c := range errors {
+		_, err := ParsePayloadConfig(c.spec)
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("ParsePayloadConfig(%q) = %v, want an error with %q", c.spec, err, c.err)
+		}
+	}
+}
+
+func TestPayloadSourceSize(t *testing.T) {
+	cases := []struct {
+		name   string
+		config PayloadConfig
+		min    int
+		max    int
+	}{
+		{"fixed", PayloadConfig{Distribution: PayloadFixed, Size: 10}, 10, 10},
+		{"uniform", PayloadConfig{Distribution: PayloadUniform, Min: 5, Max: 9}, 5, 9},
+		{"normal", PayloadConfig{Distribution: PayloadNormal, Mean: 1, StdDev: 10}, 0, 1 << 20},
+		{
+			"buckets",
+			PayloadConfig{Distribution: PayloadBuckets, Buckets: []PayloadBucket{{10, 1}, {20, 0}, {30, 1}}},
+			10, 30,
+		},
+	}
+	for _, c := range cases {
+		source, err := newPayloadSource(c.config)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		seen := map[int]bool{}
+		for i := 0; i < 1000; i++ {
+			size := source.size()
+			if size < c.min || size > c.max {
+				t.Errorf("%s: size %d out of [%d, %d]", c.name, size, c.min, c.max)
+				break
+			}
+			seen[size] = true
+		}
+		switch c.config.Distribution {
+		case PayloadUniform:
+			if !seen[c.min] || !seen[c.max] {
+				t.Errorf("%s: the bounds are not both drawn in 1000 sizes: %v", c.name, seen)
+			}
+		case PayloadNormal:
+			if !seen[0] {
+				t.Errorf("%s: the negative sizes are not clamped to 0", c.name)
+			}
+		case PayloadBuckets:
+			if seen[20] || !seen[10] || !seen[30] {
+				t.Errorf("%s: drawn %v, want 10 and 30 but not the bucket without weight", c.name, seen)
+			}
+		}
+	}
+
+	source, _ := newPayloadSource(PayloadConfig{Distribution: PayloadFixed, Size: 10})
+	if payload := source.Next(); len(payload) != 10 {
+		t.Errorf("Next() = %q, want 10 bytes", payload)
+	}
+	var none *payloadSource
+	if payload := none.Next(); payload != "" {
+		t.Errorf("Next() without payload = %q, want empty", payload)
+	}
+}
+
+func TestPayloadArgument(t *testing.T) {
+	binary := string([]byte{0xff, 0})
+	cases := []struct {
+		payload      string
+		jsonProtocol bool
+		want         interface{}
+	}{
+		{"", true, nil},
+		{"", false, nil},
+		{`{"a":1}`, true, json.RawMessage(`{"a":1}`)},
+		{"text", true, "text"},
+		{binary, true, "/wA="},
+		{`{"a":1}`, false, `{"a":1}`},
+		{"text", false, "text"},
+		{binary, false, []byte{0xff, 0}},
+	}
+	for _, c := range cases {
+		if got := payloadArgument(c.payload, c.jsonProtocol); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("payloadArgument(%q, %v) = %#v, want %#v", c.payload, c.jsonProtocol, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package benchmark
+
+import (
+	"sync/atomic"
+	"time"
+
+	"aspnet.com/util"
+)
+
+// rateTick is how often the rate scheduler sends the messages that are due.
+const rateTick = time.Millisecond
+
+// rateScheduler sends messages at a target aggregate rate round-robin over the sessions, no matter how
+// fast the server responds (open loop). Each message carries its intended send time rather than the time
+// it is actually sent, so that the time it waits behind a slow connection is counted into the latency
+// instead of being omitted.
+type rateScheduler struct {
+	sessions []*Session
+	gen      MessageGenerator
+	rate     int
+	stop     chan struct{}
+}
+
+func newRateScheduler(sessions []*Session, gen MessageGenerator, rate int) *rateScheduler {
+	return &rateScheduler{
+		sessions: sessions,
+		gen:      gen,
+		rate:     rate,
+		stop:     make(chan struct{}),
+	}
+}
+
+func (r *rateScheduler) Start() {
+	go r.run()
+}
+
+func (r *rateScheduler) Stop() {
+	close(r.stop)
+}
+
+func (r *rateScheduler) run() {
+	if r.rate <= 0 || len(r.sessions) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(rateTick)
+	defer ticker.Stop()
+
+	start := util.Now()
+	var sent int64
+	for {
+		select {
+		case <-ticker.C:
+			sent = r.tick(start, util.Now(), sent)
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// tick dispatches the messages due at now after the sent ones, and returns the number of messages sent so far.
+// The messages due are computed from the start, so a late tick sends the ones it missed.
+func (r *rateScheduler) tick(start time.Time, now time.Time, sent int64) int64 {
+	due := int64(now.Sub(start).Seconds() * float64(r.rate))
+	for ; sent < due; sent++ {
+		intended := start.Add(time.Duration(sent) * time.Second / time.Duration(r.rate))
+		r.dispatch(r.sessions[sent%int64(len(r.sessions))], intended)
+	}
+	return sent
+}
+
+// dispatch queues the message to the session without blocking. The message misses its schedule
+// if the session is reconnecting or its sending queue is full.
+func (r *rateScheduler) dispatch(session *Session, intended time.Time) {
+	if atomic.LoadInt32(&session.dropped) == 1 {
+		session.counter.Registry().Counter("message:schedule_missed").Add(1)
+		return
+	}
+	if !session.enqueue(r.gen, intended) {
+		session.counter.Registry().Counter("message:schedule_missed").Add(1)
+	}
+}
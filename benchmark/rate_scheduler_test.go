@@ -0,0 +1,87 @@
+package benchmark
+
+import (
+	"testing"
+	"time"
+
+	"aspnet.com/util"
+)
+
+// stampMessage is a message carrying only its send time.
+type stampMessage time.Time
+
+func (m stampMessage) Type() int {
+	return 0
+}
+
+func (m stampMessage) Bytes() []byte {
+	return nil
+}
+
+type stampGenerator struct{}
+
+func (g stampGenerator) Interval() time.Duration {
+	return time.Second
+}
+
+func (g stampGenerator) Generate(session *Session, sendTime time.Time) Message {
+	return stampMessage(sendTime)
+}
+
+func TestRateSchedulerTick(t *testing.T) {
+	counter := &WithCounter{registry: util.NewRegistry()}
+	var sessions []*Session
+	for _, id := range []string{"a", "b", "c"} {
+		sessions = append(sessions, NewSession(id, "", nil, counter, nil))
+	}
+	// the queue of b is full after its first message, and c is reconnecting
+	sessions[1].Sending = make(chan Message, 1)
+	sessions[2].dropped = 1
+
+	r := newRateScheduler(sessions, stampGenerator{}, 1000)
+	start := time.Unix(1000, 0)
+	cases := []struct {
+		now    time.Duration
+		sent   int64
+		missed int64
+	}{
+		// a message is due once its interval has passed
+		{500 * time.Microsecond, 0, 0},
+		{1500 * time.Microsecond, 1, 0},
+		{1900 * time.Microsecond, 1, 0},
+		{3500 * time.Microsecond, 3, 1},
+		// a late tick sends the messages it missed
+		{7500 * time.Microsecond, 7, 3},
+		{7500 * time.Microsecond, 7, 3},
+	}
+	var sent int64
+	for _, c := range cases {
+		sent = r.tick(start, start.Add(c.now), sent)
+		if sent != c.sent {
+			t.Errorf("%d messages sent at %v, want %d", sent, c.now, c.sent)
+		}
+		if missed := counter.Registry().Snapshot().Value("message:schedule_missed"); missed != c.missed {
+			t.Errorf("%d messages missed at %v, want %d", missed, c.now, c.missed)
+		}
+	}
+
+	// a is sent the messages 0, 3 and 6 and b the message 1, each at its intended time
+	want := map[int][]time.Duration{
+		0: {0, 3 * time.Millisecond, 6 * time.Millisecond},
+		1: {time.Millisecond},
+	}
+	for i, intended := range want {
+		if len(sessions[i].Sending) != len(intended) {
+			t.Errorf("%d messages queued to %s, want %d", len(sessions[i].Sending), sessions[i].ID, len(intended))
+			continue
+		}
+		for _, d := range intended {
+			if sendTime := time.Time((<-sessions[i].Sending).(stampMessage)); !sendTime.Equal(start.Add(d)) {
+				t.Errorf("message to %s intended at %v, want %v", sessions[i].ID, sendTime, start.Add(d))
+			}
+		}
+	}
+	if expected := counter.Registry().Snapshot().Value("message:expected"); expected != 4 {
+		t.Errorf("%d messages expected, want 4", expected)
+	}
+}
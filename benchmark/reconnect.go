@@ -0,0 +1,64 @@
+package benchmark
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Modes of the reconnect policy.
+const (
+	ReconnectNone      = "none"
+	ReconnectImmediate = "immediate"
+	ReconnectBackoff   = "backoff"
+)
+
+// ReconnectPolicy defines how a session rebuilds its connection after it is dropped by the server.
+type ReconnectPolicy struct {
+	// Mode is one of ReconnectNone, ReconnectImmediate and ReconnectBackoff. An empty mode means ReconnectNone.
+	Mode string
+	// MaxAttempts is the number of attempts before the session gives up, 0 means no limit.
+	MaxAttempts int
+	// InitialDelay is the backoff of the first attempt, which is doubled on each attempt up to MaxDelay.
+	InitialDelay time.Duration
+	// MaxDelay caps the backoff, defaultMaxReconnectDelay is used if it is not set.
+	MaxDelay time.Duration
+}
+
+const defaultMaxReconnectDelay = time.Minute
+
+// immediateRetryDelay is the least delay of the immediate reconnect after the first attempt fails, which is jittered
+// up to twice as long, so that the sessions of a dead server do not redial it in a tight loop.
+const immediateRetryDelay = 100 * time.Millisecond
+
+func (p *ReconnectPolicy) enabled() bool {
+	return p.Mode == ReconnectImmediate || p.Mode == ReconnectBackoff
+}
+
+func (p *ReconnectPolicy) exhausted(attempt int) bool {
+	return p.MaxAttempts > 0 && attempt >= p.MaxAttempts
+}
+
+// delay returns the time to wait before the attempt, which starts from 0.
+// The backoff is fully jittered, i.e. random within [0, backoff), so that the sessions dropped
+// at the same time do not reconnect at the same time. The immediate mode only waits to retry
+// the failed attempts, see immediateRetryDelay.
+func (p *ReconnectPolicy) delay(attempt int) time.Duration {
+	if p.Mode == ReconnectImmediate && attempt > 0 {
+		return immediateRetryDelay + time.Duration(rand.Int63n(int64(immediateRetryDelay)))
+	}
+	if p.Mode != ReconnectBackoff || p.InitialDelay <= 0 {
+		return 0
+	}
+	maxDelay := p.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = defaultMaxReconnectDelay
+	}
+	backoff := p.InitialDelay
+	for i := 0; i < attempt && backoff < maxDelay; i++ {
+		backoff *= 2
+	}
+	if backoff > maxDelay {
+		backoff = maxDelay
+	}
+	return time.Duration(rand.Int63n(int64(backoff)))
+}
@@ -0,0 +1,94 @@
+package benchmark
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReconnectPolicyDelay(t *testing.T) {
+	backoff := ReconnectPolicy{Mode: ReconnectBackoff, InitialDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	cases := []struct {
+		name    string
+		policy  ReconnectPolicy
+		attempt int
+		// the delay is within [min, max), or 0 if max is 0
+		min time.Duration
+		max time.Duration
+	}{
+		{"none", ReconnectPolicy{Mode: ReconnectNone, InitialDelay: time.Second}, 3, 0, 0},
+		{"immediate first attempt", ReconnectPolicy{Mode: ReconnectImmediate}, 0, 0, 0},
+		{"immediate retry", ReconnectPolicy{Mode: ReconnectImmediate}, 1, 100 * time.Millisecond, 200 * time.Millisecond},
+		{"immediate later retry", ReconnectPolicy{Mode: ReconnectImmediate}, 10, 100 * time.Millisecond, 200 * time.Millisecond},
+		{"backoff without initial delay", ReconnectPolicy{Mode: ReconnectBackoff}, 3, 0, 0},
+		{"backoff first attempt", backoff, 0, 0, 100 * time.Millisecond},
+		{"backoff second attempt", backoff, 1, 0, 200 * time.Millisecond},
+		{"backoff fourth attempt", backoff, 3, 0, 800 * time.Millisecond},
+		{"backoff capped", backoff, 4, 0, time.Second},
+		{"backoff capped long after", backoff, 100, 0, time.Second},
+		{
+			"backoff default cap",
+			ReconnectPolicy{Mode: ReconnectBackoff, InitialDelay: time.Second},
+			100, 0, defaultMaxReconnectDelay,
+		},
+	}
+	for _, c := range cases {
+		var low, high bool
+		for i := 0; i < 200; i++ {
+			delay := c.policy.delay(c.attempt)
+			if c.max == 0 {
+				if delay != 0 {
+					t.Errorf("%s: delay %v, want 0", c.name, delay)
+					break
+				}
+				continue
+			}
+			if delay < c.min || delay >= c.max {
+				t.Errorf("%s: delay %v, want within [%v, %v)", c.name, delay, c.min, c.max)
+				break
+			}
+			// the delays are jittered over the whole range
+			middle := c.min + (c.max-c.min)/2
+			low = low || delay < middle
+			high = high || delay >= middle
+		}
+		if c.max != 0 && !(low && high) {
+			t.Errorf("%s: 200 delays are not spread over [%v, %v)", c.name, c.min, c.max)
+		}
+	}
+}
+
+func TestReconnectPolicyExhausted(t *testing.T) {
+	cases := []struct {
+		maxAttempts int
+		attempt     int
+		want        bool
+	}{
+		{0, 0, false},
+		{0, 1000, false},
+		{1, 0, false},
+		{1, 1, true},
+		{3, 2, false},
+		{3, 3, true},
+		{3, 4, true},
+	}
+	for _, c := range cases {
+		policy := ReconnectPolicy{Mode: ReconnectBackoff, MaxAttempts: c.maxAttempts}
+		if got := policy.exhausted(c.attempt); got != c.want {
+			t.Errorf("exhausted(%d) with %d max attempts = %v, want %v", c.attempt, c.maxAttempts, got, c.want)
+		}
+	}
+}
+
+func TestReconnectPolicyEnabled(t *testing.T) {
+	for mode, want := range map[string]bool{
+		"":                 false,
+		ReconnectNone:      false,
+		ReconnectImmediate: true,
+		ReconnectBackoff:   true,
+	} {
+		policy := ReconnectPolicy{Mode: mode}
+		if got := policy.enabled(); got != want {
+			t.Errorf("enabled() of %q = %v, want %v", mode, got, want)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package benchmark
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"aspnet.com/util"
+)
+
+// Audiences of the messages published with the REST API of SignalR Service.
+const (
+	RestBroadcast = "broadcast"
+	RestUsers     = "users"
+	RestGroups    = "groups"
+)
+
+// restMaxOutstanding is the number of REST requests which can wait for their responses, beyond which
+// the messages due miss their schedule.
+const restMaxOutstanding = 4096
+
+// SignalRServiceRestMessage is the body of the REST API to send a message to the clients.
+type SignalRServiceRestMessage struct {
+	Target    string        `json:"target"`
+	Arguments []interface{} `json:"arguments"`
+}
+
+// restDestination is a URL the REST messages are posted to, and the number of local connections expecting them.
+type restDestination struct {
+	url string
+	// expected is 0 for broadcast, which goes to all the connections and is counted as message:broadcast.
+	expected int64
+}
+
+// restPublisher posts messages to the REST API of SignalR Service at the target rate round-robin over the
+// destinations, in open loop like rateScheduler: each message carries its intended send time, and the requests
+// do not wait for the previous responses. The messages are received by the connections of the subject, which
+// measure the latency from the REST call to the delivery.
+type restPublisher struct {
+	rest         *restClient
+	destinations []*restDestination
+	target       string
+	// sender identifies the publisher in the messages and the logged errors.
+	sender      string
+	payload     *payloadSource
+	rate        int
+	outstanding int64
+	stop        chan struct{}
+}
+
+func (p *restPublisher) Start() {
+	go p.run()
+}
+
+func (p *restPublisher) Stop() {
+	close(p.stop)
+}
+
+func (p *restPublisher) run() {
+	if p.rate <= 0 || len(p.destinations) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(rateTick)
+	defer ticker.Stop()
+
+	start := util.Now()
+	var sent int64
+	for {
+		select {
+		case <-ticker.C:
+			due := int64(util.Now().Sub(start).Seconds() * float64(p.rate))
+			for ; sent < due; sent++ {
+				intended := start.Add(time.Duration(sent) * time.Second / time.Duration(p.rate))
+				p.publish(p.destinations[sent%int64(len(p.destinations))], intended)
+			}
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// publish posts the message without waiting for the response. The message misses its schedule if too many
+// requests are outstanding. The stamp is only the intended send time, so that the receivers do not check its
+// sequence: the requests overlap and may fail, which is not a loss of the service.
+func (p *restPublisher) publish(destination *restDestination, intended time.Time) {
+	registry := p.rest.counter.Registry()
+	if atomic.LoadInt64(&p.outstanding) >= restMaxOutstanding {
+		registry.Counter("message:schedule_missed").Add(1)
+		return
+	}
+	arguments := []interface{}{p.sender, strconv.FormatInt(intended.UnixNano(), 10)}
+	if payload := payloadArgument(p.payload.Next(), true); payload != nil {
+		arguments = append(arguments, payload)
+	}
+	body, err := json.Marshal(&SignalRServiceRestMessage{
+		Target:    p.target,
+		Arguments: arguments,
+	})
+	if err != nil {
+		p.rest.counter.LogError("rest:error", p.sender, "Failed to encode the REST message", err)
+		return
+	}
+	atomic.AddInt64(&p.outstanding, 1)
+	registry.Gauge("rest:outstanding").Add(1)
+	go func() {
+		defer func() {
+			atomic.AddInt64(&p.outstanding, -1)
+			registry.Gauge("rest:outstanding").Add(-1)
+		}()
+		registry.Counter("message:sent").Add(1)
+		registry.Counter("message:sendSize").Add(int64(len(body)))
+		status, ok := p.rest.request(p.sender, http.MethodPost, destination.url, body, "rest")
+		if !ok || status/100 != 2 {
+			return
+		}
+		if destination.expected == 0 {
+			registry.Counter("message:broadcast").Add(1)
+		} else {
+			registry.Counter("message:expected").Add(destination.expected)
+		}
+	}()
+}
+
+// restClient calls the REST API of SignalR Service with the tokens minted from the access key.
+type restClient struct {
+	counter *WithCounter
+	client  *http.Client
+	service *ServiceConfig
+}
+
+// newRestClient creates the client of the REST API, which keeps the connections of all the outstanding requests.
+func newRestClient(counter *WithCounter, service *ServiceConfig, tlsConfig *tls.Config) *restClient {
+	client := newHTTPClient(tlsConfig)
+	client.Transport.(*http.Transport).MaxIdleConnsPerHost = restMaxOutstanding
+	return &restClient{
+		counter: counter,
+		client:  client,
+		service: service,
+	}
+}
+
+// hubURL is the REST API URL of the hub, followed by the path.
+func (c *restClient) hubURL(path string) string {
+	return c.service.Endpoint + "/api/v1/hubs/" + url.PathEscape(c.service.Hub) + path
+}
+
+// request sends the REST request with a token minted for its URL, the error is logged with the id. The response
+// time is recorded to "<series>:response" and the status code is counted to "<series>:status:<code>", or the
+// error to "<series>:error".
+func (c *restClient) request(id string, method string, requestURL string, body []byte, series string) (int, bool) {
+	token, err := c.service.mintToken(requestURL, nil)
+	if err != nil {
+		c.counter.LogError(series+":error", id, "Failed to mint the access token", err)
+		return 0, false
+	}
+	request, err := newTransportRequest(context.Background(), method, requestURL, token, bytes.NewReader(body))
+	if err != nil {
+		c.counter.LogError(series+":error", id, "Failed to make the REST request", err)
+		return 0, false
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	start := time.Now()
+	response, err := c.client.Do(request)
+	if err != nil {
+		c.counter.LogError(series+":error", id, "Failed to call the REST API", err)
+		return 0, false
+	}
+	ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	c.counter.LogDuration(series+":response", time.Since(start))
+	c.counter.Registry().Counter(series + ":status:" + strconv.Itoa(response.StatusCode)).Add(1)
+	return response.StatusCode, true
+}
@@ -0,0 +1,331 @@
+package benchmark
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Placeholders of the scenario argument templates, which are replaced for each message.
+const (
+	// ScenarioSender is the ID of the sending connection.
+	ScenarioSender = "{sender}"
+	// ScenarioName is the send name of the connection, see --send-size.
+	ScenarioName = "{name}"
+	// ScenarioGroup is the group the connection joined.
+	ScenarioGroup = "{group}"
+	// ScenarioTimestamp is the send time in Unix nanoseconds.
+	ScenarioTimestamp = "{timestamp}"
+	// ScenarioSequence is the sequence number of the message from the sender.
+	ScenarioSequence = "{sequence}"
+	// ScenarioPayload is the payload of --payload.
+	ScenarioPayload = "{payload}"
+	// ScenarioStamp is the timestamp, the sender and the sequence together, from which the receiver
+	// measures the latency and checks the sequence.
+	ScenarioStamp = "{stamp}"
+)
+
+// Scenario defines a SignalR hub to benchmark with the "signalr:scenario" subject, so that a new hub
+// can be tested without a subject of its own.
+type Scenario struct {
+	// Name is shown as the name of the subject.
+	Name string `json:"name"`
+	// Service tells to negotiate with the app server for the URL of SignalR Service, instead of connecting
+	// to the hub directly.
+	Service bool `json:"service"`
+	// Path is appended to the server host, e.g. "/chat".
+	Path string `json:"path"`
+	// Protocol is "json" or "messagepack".
+	Protocol string `json:"protocol"`
+
+	// Target is invoked with the argument templates by the "s" commands.
+	Target    string   `json:"target"`
+	Arguments []string `json:"arguments"`
+	// GroupTarget is invoked with the argument templates by the "gs" commands, optional.
+	GroupTarget    string   `json:"groupTarget"`
+	GroupArguments []string `json:"groupArguments"`
+
+	// LatencyTarget is the target of the incoming messages to measure, and LatencyArgument is the index
+	// of their argument with the stamp (or the timestamp only). By default it is the index of "{stamp}",
+	// or else "{timestamp}", in Arguments or GroupArguments, which must be the same if both have one since
+	// the messages of both targets arrive at LatencyTarget. LatencyTarget is optional for the hub methods returning a value,
+	// which are measured with --blocking-invocation.
+	LatencyTarget   string `json:"latencyTarget"`
+	LatencyArgument *int   `json:"latencyArgument"`
+
+	// JoinGroupTarget and LeaveGroupTarget are invoked with the argument templates to join and leave
+	// the groups, optional. Only "{group}" is known here.
+	JoinGroupTarget     string   `json:"joinGroupTarget"`
+	JoinGroupArguments  []string `json:"joinGroupArguments"`
+	LeaveGroupTarget    string   `json:"leaveGroupTarget"`
+	LeaveGroupArguments []string `json:"leaveGroupArguments"`
+
+	// FanOut is who receives the messages: "echo" (default), "group" or "broadcast".
+	FanOut string `json:"fanOut"`
+}
+
+// LoadScenario reads the scenario from a JSON file, or a YAML file if its extension is .yaml or .yml.
+func LoadScenario(path string) (*Scenario, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".yaml" || ext == ".yml" {
+		values, err := parseFlatYAML(data)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse %s: %v", path, err)
+		}
+		// the YAML is converted to JSON to share the field names
+		if data, err = json.Marshal(values); err != nil {
+			return nil, err
+		}
+	}
+
+	scenario := &Scenario{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(scenario); err != nil {
+		return nil, fmt.Errorf("Failed to parse %s: %v", path, err)
+	}
+	if err = scenario.validate(); err != nil {
+		return nil, fmt.Errorf("Invalid scenario %s: %v", path, err)
+	}
+	return scenario, nil
+}
+
+// validate checks the scenario and fills the defaults.
+func (s *Scenario) validate() error {
+	if s.Protocol == "" {
+		s.Protocol = "json"
+	}
+	if s.Protocol != "json" && s.Protocol != "messagepack" {
+		return fmt.Errorf("Unknown protocol: %s", s.Protocol)
+	}
+	if s.Target == "" && s.GroupTarget == "" {
+		return fmt.Errorf("Neither target nor groupTarget is defined")
+	}
+	if s.LatencyTarget != "" && s.LatencyArgument == nil {
+		// the messages of both targets arrive at the latency target, which cannot tell them apart
+		index, groupIndex := stampIndex(s.Arguments), stampIndex(s.GroupArguments)
+		if index >= 0 && groupIndex >= 0 && index != groupIndex {
+			return fmt.Errorf("The stamp is argument %d of target but %d of groupTarget, define latencyArgument", index, groupIndex)
+		}
+		if index < 0 {
+			index = groupIndex
+		}
+		if index < 0 {
+			return fmt.Errorf("latencyArgument is not defined and no argument is %s or %s", ScenarioStamp, ScenarioTimestamp)
+		}
+		s.LatencyArgument = &index
+	}
+	switch s.FanOut {
+	case "", "echo", "group", "broadcast":
+	default:
+		return fmt.Errorf("Unknown fanOut: %s", s.FanOut)
+	}
+	return nil
+}
+
+// stampIndex is the index of the argument with the stamp, or else the timestamp, -1 if there is none.
+func stampIndex(templates []string) int {
+	if index := templateIndex(templates, ScenarioStamp); index >= 0 {
+		return index
+	}
+	return templateIndex(templates, ScenarioTimestamp)
+}
+
+func templateIndex(templates []string, placeholder string) int {
+	for i, t := range templates {
+		if t == placeholder {
+			return i
+		}
+	}
+	return -1
+}
+
+// expandArguments replaces the placeholders in the argument templates for the next message of the session.
+// An argument which is only {payload} is the payload argument of payloadArgument, or an empty string if
+// there is no payload, while {payload} within an argument is replaced by the text of the payload.
+func expandArguments(templates []string, session *Session, sendTime time.Time, jsonProtocol bool) []interface{} {
+	payload := session.payload.Next()
+	replacer := strings.NewReplacer(
+		ScenarioStamp, formatStamp(sendTime, session.ID, session.invocationId),
+		ScenarioSender, session.ID,
+		ScenarioName, session.SendName,
+		ScenarioGroup, session.GroupName,
+		ScenarioTimestamp, strconv.FormatInt(sendTime.UnixNano(), 10),
+		ScenarioSequence, strconv.FormatInt(session.invocationId, 10),
+		ScenarioPayload, textPayload(payload),
+	)
+	arguments := make([]interface{}, len(templates))
+	for i, t := range templates {
+		if t == ScenarioPayload && payload != "" {
+			arguments[i] = payloadArgument(payload, jsonProtocol)
+		} else {
+			arguments[i] = replacer.Replace(t)
+		}
+	}
+	return arguments
+}
+
+// ScenarioMessageGenerator invokes the target with the expanded argument templates.
+type ScenarioMessageGenerator struct {
+	WithInterval
+	Target    string
+	Arguments []string
+	Msgpack   bool
+}
+
+var _ MessageGenerator = (*ScenarioMessageGenerator)(nil)
+
+func (g *ScenarioMessageGenerator) Generate(session *Session, sendTime time.Time) Message {
+	if g.Msgpack {
+		return GenerateMessagePackInvocation(session.blockingInvocationID(), g.Target, expandArguments(g.Arguments, session, sendTime, false))
+	}
+	return GenerateJsonInvocation(session.blockingInvocationID(), g.Target, expandArguments(g.Arguments, session, sendTime, true))
+}
+
+// parseFlatYAML parses the subset of YAML a scenario needs: a mapping of scalars and lists of scalars,
+// where a list is either in the flow style "[a, b]" or of "- item" lines below its key. A " #" out of quotes
+// starts a comment, as in YAML.
+func parseFlatYAML(data []byte) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+	var listKey string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || trimmed == "---" {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "- ") || trimmed == "-" {
+			if listKey == "" {
+				return nil, fmt.Errorf("line %d: list item without a key", lineNo)
+			}
+			item, err := parseYAMLScalar(stripYAMLComment(strings.TrimPrefix(trimmed, "-")))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNo, err)
+			}
+			values[listKey] = append(values[listKey].([]interface{}), item)
+			continue
+		}
+		if line != trimmed {
+			return nil, fmt.Errorf("line %d: nested mappings are not supported", lineNo)
+		}
+		colon := strings.Index(line, ":")
+		if colon <= 0 {
+			return nil, fmt.Errorf("line %d: expect \"key: value\"", lineNo)
+		}
+		key := strings.TrimSpace(line[:colon])
+		value := stripYAMLComment(line[colon+1:])
+		listKey = ""
+		switch {
+		case value == "":
+			// the items follow
+			listKey = key
+			values[key] = []interface{}{}
+		case strings.HasPrefix(value, "["):
+			if !strings.HasSuffix(value, "]") {
+				return nil, fmt.Errorf("line %d: unterminated list", lineNo)
+			}
+			items := []interface{}{}
+			if inner := strings.TrimSpace(value[1 : len(value)-1]); inner != "" {
+				for _, item := range splitYAMLFlow(inner) {
+					v, err := parseYAMLScalar(strings.TrimSpace(item))
+					if err != nil {
+						return nil, fmt.Errorf("line %d: %v", lineNo, err)
+					}
+					items = append(items, v)
+				}
+			}
+			values[key] = items
+		default:
+			v, err := parseYAMLScalar(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNo, err)
+			}
+			values[key] = v
+		}
+	}
+	return values, scanner.Err()
+}
+
+// stripYAMLComment removes the comment, which starts with a "#" out of quotes at the start or after a space,
+// and the surrounding spaces. A quote only starts a string at the start of a scalar, e.g. not in "it's".
+func stripYAMLComment(s string) string {
+	var quote byte
+	scalarStart := true
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '#' && (i == 0 || s[i-1] == ' ' || s[i-1] == '\t'):
+			return strings.TrimSpace(s[:i])
+		case (c == '"' || c == '\'') && scalarStart:
+			quote = c
+		}
+		if c != ' ' && c != '\t' {
+			scalarStart = quote == 0 && (c == '[' || c == ',')
+		}
+	}
+	return strings.TrimSpace(s)
+}
+
+// splitYAMLFlow splits the items of a flow list by the commas out of quotes.
+func splitYAMLFlow(s string) []string {
+	var items []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			items = append(items, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(items, s[start:])
+}
+
+func parseYAMLScalar(s string) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(s, "\""):
+		return strconv.Unquote(s)
+	case strings.HasPrefix(s, "'"):
+		if len(s) < 2 || !strings.HasSuffix(s, "'") {
+			return nil, fmt.Errorf("unterminated string %s", s)
+		}
+		return strings.Replace(s[1:len(s)-1], "''", "'", -1), nil
+	}
+	switch s {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null", "~", "":
+		return nil, nil
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n, nil
+	}
+	return s, nil
+}
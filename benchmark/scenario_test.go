@@ -0,0 +1,196 @@
+package benchmark
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseFlatYAML(t *testing.T) {
+	cases := []struct {
+		name string
+		yaml string
+		want map[string]interface{}
+	}{
+		{
+			"scalars",
+			"name: chat\nservice: true\nlatencyArgument: 1\nfanOut: ~\n",
+			map[string]interface{}{"name": "chat", "service": true, "latencyArgument": int64(1), "fanOut": nil},
+		},
+		{
+			"quoted scalars",
+			"a: \"x: \\\"y\\\"\"\nb: 'it''s'\nc: \"1\"\n",
+			map[string]interface{}{"a": `x: "y"`, "b": "it's", "c": "1"},
+		},
+		{
+			"comments",
+			"# scenario\n---\na: b # comment\nb: c#d\nc: \"e # f\" # comment\nd: it's # comment\ne: # comment\n  - x # comment\n",
+			map[string]interface{}{"a": "b", "b": "c#d", "c": "e # f", "d": "it's", "e": []interface{}{"x"}},
+		},
+		{
+			"flow lists",
+			"a: [x, \"y, z\", 'w', 1]\nb: []\nc: [x] # comment\n",
+			map[string]interface{}{
+				"a": []interface{}{"x", "y, z", "w", int64(1)},
+				"b": []interface{}{},
+				"c": []interface{}{"x"},
+			},
+		},
+		{
+			"block lists",
+			"a:\n  - x\n  - \"{stamp}\"\nb:\n-\nc: d\n",
+			map[string]interface{}{"a": []interface{}{"x", "{stamp}"}, "b": []interface{}{nil}, "c": "d"},
+		},
+	}
+	for _, c := range cases {
+		got, err := parseFlatYAML([]byte(c.yaml))
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %#v, want %#v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestParseFlatYAMLErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		yaml string
+		err  string
+	}{
+		{"item without key", "- x\n", "line 1: list item without a key"},
+		{"item after scalar", "a: b\n- x\n", "line 2: list item without a key"},
+		{"nested mapping", "a:\n  b: c\n", "line 2: nested mappings are not supported"},
+		{"no colon", "a\n", "line 1: expect"},
+		{"unterminated list", "a: [x, y\n", "line 1: unterminated list"},
+		{"unterminated string", "a: 'x\n", "line 1: unterminated string"},
+		{"invalid quoted string", "a: \"x\n", "line 1: invalid syntax"},
+	}
+	for _, c := range cases {
+		_, err := parseFlatYAML([]byte(c.yaml))
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: got error %v, want %q", c.name, err, c.err)
+		}
+	}
+}
+
+func TestLoadScenario(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scenario")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cases := []struct {
+		name            string
+		file            string
+		content         string
+		protocol        string
+		latencyArgument int
+		err             string
+	}{
+		{
+			"stamp argument",
+			"stamp.yaml",
+			"target: Echo\narguments: [\"{name}\", \"{stamp}\"]\nlatencyTarget: Echo\n",
+			"json", 1, "",
+		},
+		{
+			"timestamp argument",
+			"timestamp.yml",
+			"target: Echo\narguments:\n  - \"{timestamp}\"\n  - \"{payload}\"\nlatencyTarget: Echo\nprotocol: messagepack\n",
+			"messagepack", 0, "",
+		},
+		{
+			"group argument",
+			"group.yaml",
+			"groupTarget: SendToGroup\ngroupArguments: [\"{group}\", \"{sender}\", \"{stamp}\"]\nlatencyTarget: Receive\n",
+			"json", 2, "",
+		},
+		{
+			"same argument of both targets",
+			"both.yaml",
+			"target: Echo\narguments: [\"{sender}\", \"{stamp}\"]\ngroupTarget: SendToGroup\n" +
+				"groupArguments: [\"{group}\", \"{timestamp}\"]\nlatencyTarget: Receive\n",
+			"json", 1, "",
+		},
+		{
+			"different arguments of the targets",
+			"different.yaml",
+			"target: Echo\narguments: [\"{sender}\", \"{stamp}\"]\ngroupTarget: SendToGroup\n" +
+				"groupArguments: [\"{group}\", \"{sender}\", \"{stamp}\"]\nlatencyTarget: Receive\n",
+			"", 0, "argument 1 of target but 2 of groupTarget",
+		},
+		{
+			"explicit argument of different targets",
+			"explicitboth.yaml",
+			"target: Echo\narguments: [\"{sender}\", \"{stamp}\"]\ngroupTarget: SendToGroup\n" +
+				"groupArguments: [\"{group}\", \"{sender}\", \"{stamp}\"]\nlatencyTarget: Receive\nlatencyArgument: 2\n",
+			"json", 2, "",
+		},
+		{
+			"explicit argument",
+			"explicit.yaml",
+			"target: Echo\narguments: [\"{stamp}\", x]\nlatencyTarget: Echo\nlatencyArgument: 1 # the hub swaps them\n",
+			"json", 1, "",
+		},
+		{
+			"json",
+			"json.json",
+			`{"target": "Echo", "arguments": ["{sender}", "{stamp}"], "latencyTarget": "Echo"}`,
+			"json", 1, "",
+		},
+		{
+			"no latency argument",
+			"none.yaml",
+			"target: Echo\narguments: [\"{sender}\"]\nlatencyTarget: Echo\n",
+			"", 0, "latencyArgument is not defined",
+		},
+		{
+			"no target",
+			"notarget.yaml",
+			"arguments: [\"{stamp}\"]\n",
+			"", 0, "Neither target nor groupTarget",
+		},
+		{
+			"unknown field",
+			"unknown.yaml",
+			"target: Echo\nargs: [\"{stamp}\"]\n",
+			"", 0, "unknown field",
+		},
+		{
+			"unknown protocol",
+			"protocol.yaml",
+			"target: Echo\nprotocol: xml\n",
+			"", 0, "Unknown protocol",
+		},
+	}
+	for _, c := range cases {
+		path := filepath.Join(dir, c.file)
+		if err := ioutil.WriteFile(path, []byte(c.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		scenario, err := LoadScenario(path)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: got error %v, want %q", c.name, err, c.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if scenario.Protocol != c.protocol {
+			t.Errorf("%s: protocol %s, want %s", c.name, scenario.Protocol, c.protocol)
+		}
+		if scenario.LatencyArgument == nil || *scenario.LatencyArgument != c.latencyArgument {
+			t.Errorf("%s: latencyArgument %v, want %d", c.name, scenario.LatencyArgument, c.latencyArgument)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package benchmark
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// formatStamp encodes the send time, the sender and its sequence number into the message argument,
+// e.g. "1530000000000000000:sender:42", so that the receiver can measure the latency and check the sequence.
+func formatStamp(sendTime time.Time, sender string, sequence int64) string {
+	return strconv.FormatInt(sendTime.UnixNano(), 10) + ":" + sender + ":" + strconv.FormatInt(sequence, 10)
+}
+
+// parseStamp decodes the argument of formatStamp. The sender is empty if the argument is only a timestamp.
+func parseStamp(stamp string) (sendTime int64, sender string, sequence int64, err error) {
+	parts := strings.Split(stamp, ":")
+	sendTime, err = strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || len(parts) == 1 {
+		return
+	}
+	if len(parts) != 3 {
+		err = fmt.Errorf("Invalid message stamp: %s", stamp)
+		return
+	}
+	sender = parts[1]
+	sequence, err = strconv.ParseInt(parts[2], 10, 64)
+	return
+}
+
+// reorderWindow is how far behind the latest sequence number a missing message may still arrive
+// out of order before it is considered lost.
+const reorderWindow = 128
+
+type sequenceState struct {
+	next int64
+	// missing are the ascending sequence numbers skipped within the reorder window, nil if there is none.
+	missing []int64
+}
+
+// sequenceResult is the number of messages found lost, duplicated or out of order by a received message.
+type sequenceResult struct {
+	lost       int64
+	duplicate  int64
+	outOfOrder int64
+}
+
+// sequenceTracker tracks the sequence numbers received from each sender by each receiver.
+// The first message of a pair sets the start of the sequence, since the receiver may connect
+// or join the group after the sender starts. The messages are tracked by the single goroutine processing
+// the received messages, so the lock is only contended by drop.
+type sequenceTracker struct {
+	lock sync.Mutex
+	// states are the states of the senders by receiver.
+	states map[string]map[string]*sequenceState
+}
+
+func newSequenceTracker() *sequenceTracker {
+	return &sequenceTracker{states: make(map[string]map[string]*sequenceState)}
+}
+
+// drop removes the states of the receiver, whose session is closed.
+func (t *sequenceTracker) drop(receiver string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	delete(t.states, receiver)
+}
+
+// track checks the sequence number of a message from the sender to the receiver. A message which arrives
+// after it fell out of the reorder window is only counted as lost, which it was counted as already.
+func (t *sequenceTracker) track(sender string, receiver string, sequence int64) (result sequenceResult) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	senders, ok := t.states[receiver]
+	if !ok {
+		// copy the string so that it does not keep the received message alive
+		senders = make(map[string]*sequenceState)
+		t.states[string([]byte(receiver))] = senders
+	}
+	state, ok := senders[sender]
+	if !ok {
+		senders[string([]byte(sender))] = &sequenceState{next: sequence + 1}
+		return
+	}
+	switch {
+	case sequence == state.next:
+		state.next++
+	case sequence > state.next:
+		start := state.next
+		if oldest := sequence + 1 - reorderWindow; start < oldest {
+			// the messages out of the window are lost already
+			result.lost += oldest - start
+			start = oldest
+		}
+		for s := start; s < sequence; s++ {
+			state.missing = append(state.missing, s)
+		}
+		state.next = sequence + 1
+	default:
+		i := sort.Search(len(state.missing), func(i int) bool { return state.missing[i] >= sequence })
+		if i < len(state.missing) && state.missing[i] == sequence {
+			state.missing = append(state.missing[:i], state.missing[i+1:]...)
+			result.outOfOrder++
+		} else if state.next-sequence <= reorderWindow {
+			result.duplicate++
+		}
+	}
+
+	// the missing messages fallen out of the window are lost, they are the oldest ones
+	expired := 0
+	for expired < len(state.missing) && state.next-state.missing[expired] > reorderWindow {
+		expired++
+	}
+	if expired > 0 {
+		result.lost += int64(expired)
+		state.missing = state.missing[expired:]
+	}
+	if len(state.missing) == 0 {
+		state.missing = nil
+	}
+	return
+}
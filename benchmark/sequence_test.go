@@ -0,0 +1,109 @@
+package benchmark
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseStamp(t *testing.T) {
+	sendTime := time.Unix(1530000000, 42)
+	cases := []struct {
+		stamp    string
+		sendTime int64
+		sender   string
+		sequence int64
+		invalid  bool
+	}{
+		{formatStamp(sendTime, "sender", 7), sendTime.UnixNano(), "sender", 7, false},
+		{"1530000000000000042", 1530000000000000042, "", 0, false},
+		{"1530000000000000042:sender", 0, "", 0, true},
+		{"1530000000000000042:sender:x", 0, "", 0, true},
+		{"1530000000000000042:sender:7:payload", 0, "", 0, true},
+		{"x:sender:7", 0, "", 0, true},
+	}
+	for _, c := range cases {
+		sendTime, sender, sequence, err := parseStamp(c.stamp)
+		if c.invalid {
+			if err == nil {
+				t.Errorf("parseStamp(%q) succeeded, want an error", c.stamp)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseStamp(%q) failed: %v", c.stamp, err)
+			continue
+		}
+		if sendTime != c.sendTime || sender != c.sender || sequence != c.sequence {
+			t.Errorf("parseStamp(%q) = %d, %q, %d, want %d, %q, %d",
+				c.stamp, sendTime, sender, sequence, c.sendTime, c.sender, c.sequence)
+		}
+	}
+}
+
+// trackAll tracks the sequence numbers from a sender to a receiver and sums the results.
+func trackAll(tracker *sequenceTracker, sequences ...int64) sequenceResult {
+	var total sequenceResult
+	for _, sequence := range sequences {
+		result := tracker.track("sender", "receiver", sequence)
+		total.lost += result.lost
+		total.duplicate += result.duplicate
+		total.outOfOrder += result.outOfOrder
+	}
+	return total
+}
+
+func TestSequenceTrackerTrack(t *testing.T) {
+	cases := []struct {
+		name      string
+		sequences []int64
+		want      sequenceResult
+	}{
+		{"in order", []int64{5, 6, 7, 8}, sequenceResult{}},
+		{"gap within the window", []int64{0, 1, 4}, sequenceResult{}},
+		{"gap expired", []int64{0, 3, 3 + reorderWindow}, sequenceResult{lost: 2}},
+		{"gap beyond the window", []int64{0, 2 * reorderWindow}, sequenceResult{lost: reorderWindow}},
+		{"reorder within the window", []int64{0, 2, 1, 3}, sequenceResult{outOfOrder: 1}},
+		{"reorder beyond the window", []int64{0, 2, 2 + reorderWindow, 1}, sequenceResult{lost: 1}},
+		{"duplicate", []int64{0, 1, 1, 2}, sequenceResult{duplicate: 1}},
+		{"duplicate of reordered", []int64{0, 2, 1, 1}, sequenceResult{outOfOrder: 1, duplicate: 1}},
+	}
+	for _, c := range cases {
+		if got := trackAll(newSequenceTracker(), c.sequences...); got != c.want {
+			t.Errorf("%s: track %v = %+v, want %+v", c.name, c.sequences, got, c.want)
+		}
+	}
+}
+
+func TestSequenceTrackerPairs(t *testing.T) {
+	tracker := newSequenceTracker()
+	tracker.track("a", "receiver", 0)
+	tracker.track("b", "receiver", 10)
+	tracker.track("a", "other", 20)
+	if result := tracker.track("a", "receiver", 1); result != (sequenceResult{}) {
+		t.Errorf("track a->receiver = %+v, want in order", result)
+	}
+	if result := tracker.track("b", "receiver", 11); result != (sequenceResult{}) {
+		t.Errorf("track b->receiver = %+v, want in order", result)
+	}
+	if result := tracker.track("a", "other", 21); result != (sequenceResult{}) {
+		t.Errorf("track a->other = %+v, want in order", result)
+	}
+}
+
+func TestSequenceTrackerDrop(t *testing.T) {
+	tracker := newSequenceTracker()
+	tracker.track("a", "receiver", 0)
+	tracker.track("b", "receiver", 10)
+	tracker.track("a", "other", 20)
+	tracker.drop("receiver")
+	if len(tracker.states) != 1 {
+		t.Errorf("%d receivers tracked, want 1", len(tracker.states))
+	}
+	// the sequence starts again, without a gap
+	if result := tracker.track("a", "receiver", 5); result != (sequenceResult{}) {
+		t.Errorf("track a->receiver after drop = %+v, want a new sequence", result)
+	}
+	if result := tracker.track("a", "other", 21); result != (sequenceResult{}) {
+		t.Errorf("track a->other = %+v, want in order", result)
+	}
+}
@@ -0,0 +1,133 @@
+package benchmark
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultServiceTokenLifetime is the lifetime of the access tokens of SignalR Service if it is not set.
+const DefaultServiceTokenLifetime = time.Hour
+
+// ServiceConfig lets the SignalR Service subjects connect to the client endpoint of the service directly, with
+// the access tokens minted from the access key, instead of negotiating with an app server for the URL and the token.
+type ServiceConfig struct {
+	// Endpoint is the URL of the service without trailing slash, e.g. https://<name>.service.signalr.net:443.
+	Endpoint  string
+	AccessKey string
+	Hub       string
+	// Audience of the client tokens, the client URL of the hub if it is empty.
+	Audience string
+	// UserIDClaims are the claims carrying the user ID of a connection, which is the ID of the client.
+	// The tokens have no user ID if there is none.
+	UserIDClaims  []string
+	TokenLifetime time.Duration
+}
+
+// ParseConnectionString parses the connection string of SignalR Service, e.g.
+// "Endpoint=https://<name>.service.signalr.net;AccessKey=<key>;Version=1.0;", the Port is added to the endpoint.
+func ParseConnectionString(connectionString string) (*ServiceConfig, error) {
+	properties := make(map[string]string)
+	for _, part := range strings.Split(connectionString, ";") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("Invalid connection string property: %s", part)
+		}
+		properties[strings.ToLower(strings.TrimSpace(kv[0]))] = strings.TrimSpace(kv[1])
+	}
+
+	endpoint, err := url.Parse(properties["endpoint"])
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("Invalid endpoint in the connection string: %s", properties["endpoint"])
+	}
+	if properties["accesskey"] == "" {
+		return nil, fmt.Errorf("No AccessKey in the connection string")
+	}
+	if port, ok := properties["port"]; ok {
+		if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+			return nil, fmt.Errorf("Invalid port in the connection string: %s", port)
+		}
+		endpoint.Host = endpoint.Hostname() + ":" + port
+	}
+	return &ServiceConfig{
+		Endpoint:      strings.TrimSuffix(endpoint.Scheme+"://"+endpoint.Host+endpoint.Path, "/"),
+		AccessKey:     properties["accesskey"],
+		TokenLifetime: DefaultServiceTokenLifetime,
+	}, nil
+}
+
+// ClientURL is the URL of the clients of the hub, which is also the default audience of their tokens.
+func (c *ServiceConfig) ClientURL() string {
+	return c.Endpoint + "/client/?hub=" + url.QueryEscape(c.Hub)
+}
+
+// ClientToken mints the access token of the client with the user ID.
+func (c *ServiceConfig) ClientToken(userID string) (string, error) {
+	audience := c.Audience
+	if audience == "" {
+		audience = c.ClientURL()
+	}
+	claims := map[string]interface{}{}
+	if userID != "" {
+		for _, claim := range c.UserIDClaims {
+			claims[claim] = userID
+		}
+	}
+	return c.mintToken(audience, claims)
+}
+
+// jwtHeader is the encoded header of the HS256 tokens.
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// mintToken signs a JWT for the audience with HS256 and the access key, like the SDK of SignalR Service.
+// The claims are added to the registered claims.
+func (c *ServiceConfig) mintToken(audience string, claims map[string]interface{}) (string, error) {
+	lifetime := c.TokenLifetime
+	if lifetime <= 0 {
+		lifetime = DefaultServiceTokenLifetime
+	}
+	now := time.Now()
+	payload := map[string]interface{}{
+		"aud": audience,
+		"iat": now.Unix(),
+		"nbf": now.Unix(),
+		"exp": now.Add(lifetime).Unix(),
+	}
+	for claim, value := range claims {
+		payload[claim] = value
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	signingInput := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(data)
+	mac := hmac.New(sha256.New, []byte(c.AccessKey))
+	mac.Write([]byte(signingInput))
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// serviceTokenDial connects to the client endpoint of the service with a token minted for the client,
+// without negotiate. The error is logged and counted to errorGroup.
+func (s *SignalrCoreCommon) serviceTokenDial(id string, errorGroup string) (Transport, error) {
+	token, err := s.service.ClientToken(id)
+	if err != nil {
+		s.LogError(errorGroup, id, "Failed to mint the access token", err)
+		return nil, err
+	}
+	wsURL := "ws" + strings.TrimPrefix(s.service.ClientURL(), "http") + "&access_token=" + url.QueryEscape(token)
+	c, err := s.dialWebSocket(wsURL, s.tlsConfig, s.sourceAddrs)
+	if err != nil {
+		s.LogError(errorGroup, id, "Failed to connect to websocket", err)
+		return nil, err
+	}
+	return c, nil
+}
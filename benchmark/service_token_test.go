@@ -0,0 +1,130 @@
+package benchmark
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseConnectionString(t *testing.T) {
+	cases := []struct {
+		connectionString string
+		endpoint         string
+		accessKey        string
+		err              string
+	}{
+		{"Endpoint=https://a.service.signalr.net;AccessKey=key;Version=1.0;", "https://a.service.signalr.net", "key", ""},
+		{" endpoint = http://localhost/ ; accesskey = k=ey ", "http://localhost", "k=ey", ""},
+		{"Endpoint=https://a.service.signalr.net:443/;AccessKey=key;Port=8080", "https://a.service.signalr.net:8080", "key", ""},
+		{"Endpoint=https://a.service.signalr.net/base;AccessKey=key;", "https://a.service.signalr.net/base", "key", ""},
+		{"Endpoint=https://a.service.signalr.net;AccessKey=key;Port=65536", "", "", "Invalid port"},
+		{"Endpoint=https://a.service.signalr.net;Version=1.0", "", "", "No AccessKey"},
+		{"Endpoint=https://a.service.signalr.net;AccessKey=", "", "", "No AccessKey"},
+		{"Endpoint=ws://a.service.signalr.net;AccessKey=key", "", "", "Invalid endpoint"},
+		{"Endpoint=a.service.signalr.net;AccessKey=key", "", "", "Invalid endpoint"},
+		{"AccessKey=key", "", "", "Invalid endpoint"},
+		{"Endpoint;AccessKey=key", "", "", "Invalid connection string property"},
+	}
+	for _, c := range cases {
+		config, err := ParseConnectionString(c.connectionString)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("ParseConnectionString(%q) error %v, want %q", c.connectionString, err, c.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseConnectionString(%q) failed: %v", c.connectionString, err)
+			continue
+		}
+		if config.Endpoint != c.endpoint || config.AccessKey != c.accessKey || config.TokenLifetime != DefaultServiceTokenLifetime {
+			t.Errorf("ParseConnectionString(%q) = %+v, want endpoint %s access key %s",
+				c.connectionString, config, c.endpoint, c.accessKey)
+		}
+	}
+}
+
+// verifyToken checks the header and the HS256 signature of the JWT with the key, and returns its claims.
+func verifyToken(t *testing.T, token string, key string) map[string]interface{} {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("token %s has %d parts, want 3", token, len(parts))
+	}
+	header, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var headerFields map[string]string
+	if err = json.Unmarshal(header, &headerFields); err != nil {
+		t.Fatal(err)
+	}
+	if headerFields["alg"] != "HS256" || headerFields["typ"] != "JWT" {
+		t.Errorf("token header %s, want HS256 JWT", header)
+	}
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		t.Errorf("token signature does not match the key")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var claims map[string]interface{}
+	if err = json.Unmarshal(payload, &claims); err != nil {
+		t.Fatal(err)
+	}
+	return claims
+}
+
+func TestClientToken(t *testing.T) {
+	config, err := ParseConnectionString("Endpoint=https://a.service.signalr.net;AccessKey=secret;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Hub = "chat hub"
+	config.UserIDClaims = []string{"asrs.s.uid", "sub"}
+	config.TokenLifetime = 10 * time.Minute
+
+	now := time.Now().Unix()
+	token, err := config.ClientToken("user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := verifyToken(t, token, "secret")
+	if aud := claims["aud"]; aud != "https://a.service.signalr.net/client/?hub=chat+hub" {
+		t.Errorf("aud %v, want the client URL", aud)
+	}
+	for _, claim := range config.UserIDClaims {
+		if claims[claim] != "user" {
+			t.Errorf("%s %v, want user", claim, claims[claim])
+		}
+	}
+	iat, _ := claims["iat"].(float64)
+	nbf, _ := claims["nbf"].(float64)
+	exp, _ := claims["exp"].(float64)
+	if int64(iat) < now || int64(iat) > now+1 || nbf != iat || int64(exp-iat) != 600 {
+		t.Errorf("iat %v nbf %v exp %v, want now and 10 minutes later", claims["iat"], claims["nbf"], claims["exp"])
+	}
+
+	config.Audience = "https://audience"
+	config.UserIDClaims = nil
+	if token, err = config.ClientToken("user"); err != nil {
+		t.Fatal(err)
+	}
+	claims = verifyToken(t, token, "secret")
+	if aud := claims["aud"]; aud != "https://audience" {
+		t.Errorf("aud %v, want https://audience", aud)
+	}
+	if len(claims) != 4 {
+		t.Errorf("claims %v, want only the registered claims", claims)
+	}
+}
@@ -2,20 +2,26 @@ package benchmark
 
 import (
 	"bytes"
-	"fmt"
 	"log"
 	"math/rand"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"aspnet.com/util"
 	"github.com/gorilla/websocket"
 )
 
-// Session represents a single connection to the given websocket host.
+// sendingQueueSize is the number of messages that can wait to be sent on a session, so that the rate
+// scheduler does not have to wait for the connection. The interval generators do not use the queue,
+// see generate.
+const sendingQueueSize = 16
+
+// Session represents a single connection to the given host, over a WebSocket or another Transport.
 type Session struct {
 	ID            string
-	Conn          *websocket.Conn
+	Conn          Transport
 	Control       chan string
 	Sending       chan Message
 	received      chan MessageReceived
@@ -25,35 +31,89 @@ type Session struct {
 	GroupName     string
 	SendName      string
 
-	counter *util.Counter
+	counter *WithCounter
+
+	// connectStart is when the connection started to be built, and handshakeStart is when
+	// the SignalR handshake request was sent. They are used to time the handshake and the time to ready.
+	connectStart   time.Time
+	handshakeStart time.Time
+
+	// protocol is negotiated again when the connection is rebuilt by redial following reconnectPolicy.
+	protocol        string
+	reconnectPolicy ReconnectPolicy
+	redial          func() (Transport, error)
+	// reconnectStart is when the connection was dropped, it is reset when the handshake of the new connection completes.
+	reconnectStart time.Time
+	// dropped is 1 when the connection is being rebuilt, and the generator skips the messages meanwhile.
+	dropped int32
+	// closing is 1 once the session is closed by us, so that it is not reconnected.
+	closing int32
+	closed  chan struct{}
+	// connLock guards Conn which is replaced by reconnections.
+	connLock sync.Mutex
+	// joinGroup is the message sent again after reconnected, nil if the session is not in a group.
+	joinGroup Message
+
+	// fanOut tells who receives the messages of the session, and groupSize is the number of members
+	// of its group, see countExpected.
+	fanOut    int
+	groupSize int64
+	// payload is carried by the generated messages.
+	payload *payloadSource
+	// invocations tracks the blocking invocations of the generated messages, nil if they are not blocking.
+	invocations *invocationTracker
+	// sequences checks the sequences of the received messages, whose states of the session are dropped
+	// when it is closed. It is nil if the subject does not check them.
+	sequences *sequenceTracker
+	// streamId is the ID of the last stream started by the session.
+	streamId int64
+
+	// keepAlive pings the server and closes the connection if the server is silent, see checkKeepAlive.
+	// lastSent and lastReceived are in Unix nanoseconds.
+	keepAlive      KeepAlivePolicy
+	keepAliveTimer *wheelTimer
+	lastSent       int64
+	lastReceived   int64
 
 	genLock  sync.Mutex
-	genClose chan struct{}
+	genTimer *wheelTimer
 }
 
-func NewSession(id string, sendName string, received chan MessageReceived, counter *util.Counter, conn *websocket.Conn) *Session {
+func NewSession(id string, sendName string, received chan MessageReceived, counter *WithCounter, conn Transport) *Session {
 	s := new(Session)
 	s.ID = id
 	s.SendName = sendName
 	s.counter = counter
 	s.Conn = conn
 	s.Control = make(chan string)
-	s.Sending = make(chan Message)
+	s.Sending = make(chan Message, sendingQueueSize)
 	s.received = received
 	s.States = make(chan string)
+	s.closed = make(chan struct{})
 	s.genLock = sync.Mutex{}
 	s.recvHandShake = false
 	return s
 }
 
 func (s *Session) Start() {
+	s.lastReceived = time.Now().UnixNano()
 	go s.sendingWorker()
 	go s.receivedWorker(s.ID)
 }
 
 func (s *Session) NegotiateProtocol(protocol string) {
-	s.WriteTextMessage("{\"protocol\":\"" + protocol + "\",\"version\":1}\x1e")
+	s.protocol = protocol
+	s.WriteMessage(s.handshakeMessage())
+}
+
+// handshakeMessage starts the handshake of the protocol.
+func (s *Session) handshakeMessage() Message {
 	s.recvHandShake = false
+	s.handshakeStart = time.Now()
+	return PlainMessage{
+		tpe:          websocket.TextMessage,
+		messageBytes: []byte("{\"protocol\":\"" + s.protocol + "\",\"version\":1}\x1e"),
+	}
 }
 
 func (s *Session) WriteTextMessage(msg string) {
@@ -67,29 +127,87 @@ func (s *Session) WriteMessage(msg Message) {
 	s.Sending <- msg
 }
 
+// tryWriteMessage queues the message without blocking, it returns false if the queue is full.
+func (s *Session) tryWriteMessage(msg Message) bool {
+	select {
+	case s.Sending <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
 func (s *Session) InstallMessageGeneator(gen MessageGenerator) {
 	s.genLock.Lock()
 	defer s.genLock.Unlock()
 
 	s.removeMessageGeneratorUnsafe()
 
-	s.genClose = make(chan struct{})
-	go func() {
-		// randomize the start time of the generator
-		time.Sleep(time.Millisecond * time.Duration(rand.Int()%1000))
-		ticker := time.NewTicker(gen.Interval())
-		defer ticker.Stop()
-
-		for {
-			select {
-			case <-ticker.C:
-				s.Sending <- gen.Generate(s.SendName, s.GroupName, s.invocationId)
-				s.invocationId++
-			case <-s.genClose:
-				return
-			}
+	// randomize the start time of the generator
+	delay := time.Millisecond*time.Duration(rand.Int()%1000) + gen.Interval()
+	s.genTimer = sessionWheels.Schedule(delay, gen.Interval(), func() {
+		s.generate(gen)
+	})
+}
+
+// generate queues a message of the generator. It runs on the shared timer wheel so it must not block:
+// the message is skipped if the session is reconnecting or the previous messages are not sent yet,
+// the same as a time.Ticker drops the ticks a slow receiver misses, and counted as message:skipped.
+// Unlike the rate scheduler, it does not queue behind the messages waiting to be sent, so that the closed
+// loop sending keeps at most one message ahead of the connection, as it did with an unbuffered queue.
+func (s *Session) generate(gen MessageGenerator) {
+	if atomic.LoadInt32(&s.dropped) == 1 || len(s.Sending) > 0 || !s.enqueue(gen, util.Now()) {
+		// resume once reconnected or the queue is drained
+		s.counter.Registry().Counter("message:skipped").Add(1)
+	}
+}
+
+// enqueue queues the next message of the generator without blocking, and tracks its invocation if blocking.
+// It returns false if the queue is full.
+func (s *Session) enqueue(gen MessageGenerator, sendTime time.Time) bool {
+	msg := gen.Generate(s, sendTime)
+	// the invocation is tracked before it is sent, in case the completion arrives first
+	id := s.invocationId
+	if s.invocations != nil {
+		s.invocations.start(s.ID, id, sendTime)
+		s.counter.Registry().Gauge("invocation:outstanding").Add(1)
+	}
+	select {
+	case s.Sending <- msg:
+		s.invocationId++
+		s.countExpected()
+		if s.invocations != nil {
+			s.counter.Registry().Counter("invocation:sent").Add(1)
 		}
-	}()
+		return true
+	default:
+		if s.invocations != nil {
+			s.invocations.cancel(s.ID, id)
+			s.counter.Registry().Gauge("invocation:outstanding").Add(-1)
+		}
+		return false
+	}
+}
+
+// blockingInvocationID is the invocationId of the next message if the invocations are blocking, or else empty.
+func (s *Session) blockingInvocationID() string {
+	if s.invocations == nil {
+		return ""
+	}
+	return strconv.FormatInt(s.invocationId, 10)
+}
+
+// countExpected counts the receivers expected for a message sent by the session, so that the completeness
+// of the delivery can be told from message:received.
+func (s *Session) countExpected() {
+	switch s.fanOut {
+	case FanOutBroadcast:
+		s.counter.Registry().Counter("message:broadcast").Add(1)
+	case FanOutGroup:
+		s.counter.Registry().Counter("message:expected").Add(atomic.LoadInt64(&s.groupSize))
+	default:
+		s.counter.Registry().Counter("message:expected").Add(1)
+	}
 }
 
 func (s *Session) RemoveMessageGenerator() {
@@ -100,20 +218,47 @@ func (s *Session) RemoveMessageGenerator() {
 }
 
 func (s *Session) removeMessageGeneratorUnsafe() {
-	if s.genClose != nil {
-		close(s.genClose)
-		s.genClose = nil
+	if s.genTimer != nil {
+		s.genTimer.Stop()
+		s.genTimer = nil
 	}
 }
 
+func (s *Session) setJoinGroup(msg Message) {
+	s.genLock.Lock()
+	defer s.genLock.Unlock()
+	s.joinGroup = msg
+}
+
+func (s *Session) getJoinGroup() Message {
+	s.genLock.Lock()
+	defer s.genLock.Unlock()
+	return s.joinGroup
+}
+
+func (s *Session) conn() Transport {
+	s.connLock.Lock()
+	defer s.connLock.Unlock()
+	return s.Conn
+}
+
 func (s *Session) sendMessage(msg Message) {
-	err := s.Conn.WriteMessage(msg.Type(), msg.Bytes())
-	s.counter.Stat("message:sent", 1)
-	s.counter.Stat("message:sendSize", int64(len(msg.Bytes())))
+	s.writeMessage(s.conn(), msg)
+}
+
+// writeMessage writes the message on the connection and counts it.
+func (s *Session) writeMessage(conn Transport, msg Message) error {
+	err := conn.WriteMessage(msg.Type(), msg.Bytes())
+	if s.keepAlive.Interval > 0 {
+		atomic.StoreInt64(&s.lastSent, time.Now().UnixNano())
+	}
+	s.counter.Registry().Counter("message:sent").Add(1)
+	s.counter.Registry().Counter("message:sendSize").Add(int64(len(msg.Bytes())))
 	if err != nil {
 		log.Println("Error sending message: ", err)
-		s.counter.Stat("message:send_error", 1)
+		s.counter.Registry().Counter("message:send_error").Add(1)
 	}
+	return err
 }
 
 func (s *Session) sendingWorker() {
@@ -122,9 +267,14 @@ func (s *Session) sendingWorker() {
 		case control := <-s.Control:
 			switch control {
 			case "close":
-				s.counter.Stat("connection:closing", 1)
+				s.counter.Registry().Gauge("connection:closing").Add(1)
+				s.connLock.Lock()
+				atomic.StoreInt32(&s.closing, 1)
+				conn := s.Conn
+				s.connLock.Unlock()
+				close(s.closed)
 				// s.sendMessage(CloseMessage{})
-				s.Conn.Close()
+				conn.Close()
 				return
 			default:
 				log.Println("Received unhandled control message: ", control)
@@ -136,29 +286,55 @@ func (s *Session) sendingWorker() {
 }
 
 func (s *Session) receivedWorker(id string) {
-	defer s.Conn.Close()
+	defer func() {
+		s.stopKeepAlive()
+		s.conn().Close()
+		if s.sequences != nil {
+			s.sequences.drop(id)
+		}
+	}()
 	for {
-		_, msg, err := s.Conn.ReadMessage()
+		_, msg, err := s.conn().ReadMessage()
 		if err != nil {
-			s.counter.Stat("connection:established", -1)
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure) {
+			s.counter.Registry().Gauge("connection:established").Add(-1)
+			if atomic.LoadInt32(&s.closing) == 0 && s.reconnect(err) {
+				continue
+			}
+			if atomic.LoadInt32(&s.closing) == 0 && websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure) {
 				log.Println("Failed to read incoming message:", err)
-				s.counter.Stat("message:receive_error", 1)
+				s.counter.Registry().Counter("message:receive_error").Add(1)
 				s.States <- "error"
 			} else {
-				s.counter.Stat("connection:closing", -1)
-				s.counter.Stat("connection:closed", 1)
+				s.counter.Registry().Gauge("connection:closing").Add(-1)
+				s.counter.Registry().Counter("connection:closed").Add(1)
 				s.States <- "closed"
 			}
 			break
 		}
+		if s.keepAlive.ServerTimeout > 0 {
+			atomic.StoreInt64(&s.lastReceived, time.Now().UnixNano())
+		}
 		if !s.recvHandShake {
 			dataArray := bytes.Split(msg, []byte{0x1e})
 			if len(dataArray[0]) == 2 {
 				// empty json "{}"
 				s.recvHandShake = true
+				s.counter.LogDuration(ConnectHandshake, time.Since(s.handshakeStart))
+				s.startKeepAlive()
+				if !s.reconnectStart.IsZero() {
+					s.counter.Registry().Counter("connection:reconnected").Add(1)
+					s.counter.LogDuration("connection:reconnect", time.Since(s.reconnectStart))
+					s.reconnectStart = time.Time{}
+				} else if !s.connectStart.IsZero() {
+					s.counter.LogDuration(ConnectReady, time.Since(s.connectStart))
+				}
+				// the messages may follow the handshake response in the same frame, e.g. over long polling
+				if rest := bytes.TrimPrefix(msg[len(dataArray[0]):], []byte{0x1e}); len(rest) > 0 {
+					s.received <- MessageReceived{id, rest}
+				}
 			} else {
-				fmt.Errorf("Handshake fail because %s\n", dataArray[0])
+				log.Printf("Handshake fail because %s\n", dataArray[0])
+				s.counter.Registry().Counter("connection:handshake_error").Add(1)
 			}
 		} else {
 			s.received <- MessageReceived{id, msg}
@@ -166,6 +342,60 @@ func (s *Session) receivedWorker(id string) {
 	}
 }
 
+// reconnect rebuilds the dropped connection following the reconnect policy, then negotiates the protocol and
+// joins the group again. It returns false if the policy is not enabled, the attempts are exhausted or the
+// session is closed meanwhile.
+func (s *Session) reconnect(cause error) bool {
+	if s.redial == nil || !s.reconnectPolicy.enabled() {
+		return false
+	}
+	log.Println("Connection dropped, reconnecting:", cause)
+	s.conn().Close()
+	atomic.StoreInt32(&s.dropped, 1)
+	s.reconnectStart = time.Now()
+
+	for attempt := 0; !s.reconnectPolicy.exhausted(attempt); attempt++ {
+		select {
+		case <-time.After(s.reconnectPolicy.delay(attempt)):
+		case <-s.closed:
+			return false
+		}
+
+		s.counter.Registry().Counter("connection:reconnect_attempt").Add(1)
+		conn, err := s.redial()
+		if err != nil {
+			continue
+		}
+
+		// the handshake and the group are written on the new connection before it is installed, so that they go
+		// ahead of the messages queued in Sending meanwhile, which are only written to the installed connection
+		if s.writeMessage(conn, s.handshakeMessage()) != nil {
+			conn.Close()
+			continue
+		}
+		if joinGroup := s.getJoinGroup(); joinGroup != nil && s.writeMessage(conn, joinGroup) != nil {
+			conn.Close()
+			continue
+		}
+
+		s.connLock.Lock()
+		if atomic.LoadInt32(&s.closing) == 1 {
+			s.connLock.Unlock()
+			conn.Close()
+			return false
+		}
+		s.Conn = conn
+		s.connLock.Unlock()
+		atomic.StoreInt64(&s.lastReceived, time.Now().UnixNano())
+		s.counter.Registry().Gauge("connection:established").Add(1)
+		atomic.StoreInt32(&s.dropped, 0)
+		return true
+	}
+
+	s.counter.Registry().Counter("connection:reconnect_failed").Add(1)
+	return false
+}
+
 func (s *Session) Close() {
 	defer func() {
 		if r := recover(); r != nil {
@@ -173,5 +403,6 @@ func (s *Session) Close() {
 		}
 	}()
 	s.RemoveMessageGenerator()
+	s.stopKeepAlive()
 	s.Control <- "close"
 }
@@ -3,16 +3,14 @@ package benchmark
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"net"
-	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
 	"aspnet.com/util"
-	"github.com/gorilla/websocket"
 	"github.com/teris-io/shortid"
 	"github.com/vmihailenco/msgpack"
 )
@@ -33,8 +31,18 @@ type SignalrCoreCommon struct {
 	ProtocolProcessing
 	WithCounter
 	WithSessions
-	JsonReceiveFuncs    []func(p ProtocolProcessing, content SignalRCoreInvocation, recvSize int64) bool
-	MsgpackReceiveFuncs []func(p ProtocolProcessing, content MsgpackInvocation, recvSize int64) bool
+	// The receive funcs are called with the ID of the receiving client, the message and its size.
+	JsonReceiveFuncs    []func(p ProtocolProcessing, clientID string, content SignalRCoreInvocation, recvSize int64) bool
+	MsgpackReceiveFuncs []func(p ProtocolProcessing, clientID string, content MsgpackInvocation, recvSize int64) bool
+	sequences           *sequenceTracker
+	streams             *streamTracker
+	uploads             *uploadTracker
+	// skipNegotiation, negotiateVersion and transportFallback tell how the core subjects connect, see Config.
+	skipNegotiation   bool
+	negotiateVersion  int
+	transportFallback bool
+	// service is set to connect the service subjects with local access tokens, see Config.
+	service *ServiceConfig
 }
 
 func (s *SignalrCoreCommon) IsJson() bool {
@@ -60,17 +68,60 @@ func (s *SignalrCoreCommon) LeaveGroupTarget() string {
 func (s *SignalrCoreCommon) Setup(config *Config, p ProtocolProcessing) error {
 	s.host = config.Host
 	s.useWss = config.UseWss
+	tlsConfig, err := config.TLS.Build()
+	if err != nil {
+		return err
+	}
+	s.tlsConfig = tlsConfig
+	s.httpClient = newHTTPClient(tlsConfig)
+	if s.sourceAddrs, err = newSourceAddrs(config.SourceIPs); err != nil {
+		return err
+	}
 	s.sendSize = config.SendSize
-	s.counter = util.NewCounter()
+	if s.payload, err = newPayloadSource(config.Payload); err != nil {
+		return err
+	}
+	s.reconnectPolicy = config.Reconnect
+	s.keepAlive = config.KeepAlive
+	s.skipNegotiation = config.SkipNegotiation
+	s.negotiateVersion = config.NegotiateVersion
+	s.transportFallback = config.TransportFallback
+	s.service = config.Service
+	s.fanOut = FanOutEcho
+	if f, ok := p.(fanOutSubject); ok {
+		s.fanOut = f.FanOut()
+	}
+	if s.registry != nil {
+		// stop the metrics of the previous run
+		s.registry.Stop()
+	}
+	s.registry = util.NewRegistry()
+	if s.invocations != nil {
+		s.invocations.Stop()
+		s.invocations = nil
+	}
+	if config.BlockingInvocation {
+		s.invocations = newInvocationTracker(config.InvocationTimeout, s.registry)
+	}
+	if s.streams != nil {
+		s.streams.Stop()
+	}
+	s.streams = newStreamTracker(config.InvocationTimeout, &s.WithCounter)
+	if s.uploads != nil {
+		s.uploads.Stop()
+	}
+	s.uploads = newUploadTracker(config.InvocationTimeout, s.registry)
+	s.SetLatencyBuckets(config.LatencyBuckets)
 	s.sessions = make([]*Session, 0, 30000)
 	s.received = make(chan MessageReceived)
+	s.sequences = newSequenceTracker()
 	if p.IsJson() {
-		s.JsonReceiveFuncs = make([]func(ProtocolProcessing, SignalRCoreInvocation, int64) bool, 0, 2)
+		s.JsonReceiveFuncs = make([]func(ProtocolProcessing, string, SignalRCoreInvocation, int64) bool, 0, 2)
 		s.JsonReceiveFuncs = append(s.JsonReceiveFuncs, s.ProcessJsonLatency)
 		s.JsonReceiveFuncs = append(s.JsonReceiveFuncs, s.ProcessJsonJoinLeaveGroup)
 		go s.ProcessJson(p)
 	} else if p.IsMsgpack() {
-		s.MsgpackReceiveFuncs = make([]func(ProtocolProcessing, MsgpackInvocation, int64) bool, 0, 2)
+		s.MsgpackReceiveFuncs = make([]func(ProtocolProcessing, string, MsgpackInvocation, int64) bool, 0, 2)
 		s.MsgpackReceiveFuncs = append(s.MsgpackReceiveFuncs, s.ProcessMsgPackLatency)
 		s.MsgpackReceiveFuncs = append(s.MsgpackReceiveFuncs, s.ProcessMsgPackJoinLeaveGroup)
 		go s.ProcessMsgPack(p)
@@ -78,11 +129,26 @@ func (s *SignalrCoreCommon) Setup(config *Config, p ProtocolProcessing) error {
 	return nil
 }
 
+// SignalrCoreBaseConnect connects to the SignalR core server with WebSockets, or the other transports if
+// the fallback is enabled and WebSockets is not available.
 func (s *SignalrCoreCommon) SignalrCoreBaseConnect(protocol string) (session *Session, err error) {
+	if s.skipNegotiation {
+		return s.baseConnect(protocol, s.coreDial)
+	}
+	transports := []string{TransportWebSockets}
+	if s.transportFallback {
+		transports = append(transports, TransportServerSentEvents, TransportLongPolling)
+	}
+	return s.baseConnect(protocol, s.negotiateDial(protocol, transports...))
+}
+
+// baseConnect builds a session with the transport made by dial, which logs and counts its error to errorGroup.
+// The session is built again with dial when it is dropped, following the reconnect policy.
+func (s *SignalrCoreCommon) baseConnect(protocol string, dial func(id string, errorGroup string) (Transport, error)) (session *Session, err error) {
 	defer func() {
 		if err != nil {
-			s.counter.Stat("connection:inprogress", -1)
-			s.counter.Stat("connection:error", 1)
+			s.registry.Gauge("connection:inprogress").Add(-1)
+			s.registry.Counter("connection:error").Add(1)
 		}
 	}()
 
@@ -98,18 +164,28 @@ func (s *SignalrCoreCommon) SignalrCoreBaseConnect(protocol string) (session *Se
 		sendName = RandStringBytesMaskImprSrc(s.sendSize)
 	}
 
-	s.counter.Stat("connection:inprogress", 1)
-	wsURL := "ws://" + s.host
-	c, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	s.registry.Gauge("connection:inprogress").Add(1)
+	start := time.Now()
+	c, err := dial(id, "connection:error")
 	if err != nil {
-		s.LogError("connection:error", id, "Failed to connect to websocket", err)
 		return nil, err
 	}
 
-	session = NewSession(id, sendName, s.received, s.counter, c)
+	session = NewSession(id, sendName, s.received, &s.WithCounter, c)
 	if session != nil {
-		s.counter.Stat("connection:inprogress", -1)
-		s.counter.Stat("connection:established", 1)
+		session.connectStart = start
+		session.protocol = protocol
+		session.reconnectPolicy = s.reconnectPolicy
+		session.fanOut = s.fanOut
+		session.payload = s.payload
+		session.invocations = s.invocations
+		session.sequences = s.sequences
+		session.keepAlive = s.keepAlive
+		session.redial = func() (Transport, error) {
+			return dial(id, "connection:reconnect_error")
+		}
+		s.registry.Gauge("connection:inprogress").Add(-1)
+		s.registry.Gauge("connection:established").Add(1)
 
 		session.Start()
 		session.NegotiateProtocol(protocol)
@@ -120,6 +196,21 @@ func (s *SignalrCoreCommon) SignalrCoreBaseConnect(protocol string) (session *Se
 	return
 }
 
+// coreDial connects to the SignalR core server with WebSockets without negotiate, the error is logged and
+// counted to errorGroup.
+func (s *SignalrCoreCommon) coreDial(id string, errorGroup string) (Transport, error) {
+	scheme := "ws://"
+	if s.useWss {
+		scheme = "wss://"
+	}
+	c, err := s.dialWebSocket(scheme+s.host, s.tlsConfig, s.sourceAddrs)
+	if err != nil {
+		s.LogError(errorGroup, id, "Failed to connect to websocket", err)
+		return nil, err
+	}
+	return c, nil
+}
+
 func (s *SignalrCoreCommon) SignalrCoreJsonConnect() (*Session, error) {
 	return s.SignalrCoreBaseConnect("json")
 }
@@ -128,31 +219,27 @@ func (s *SignalrCoreCommon) SignalrCoreMsgPackConnect() (session *Session, err e
 	return s.SignalrCoreBaseConnect("messagepack")
 }
 
+// SignalrServiceBaseConnect connects to SignalR Service with the URL and the token from the app server, or directly
+// with a token of its own if the connection string is given.
 func (s *SignalrCoreCommon) SignalrServiceBaseConnect(protocol string) (session *Session, err error) {
-	defer func() {
-		if err != nil {
-			s.counter.Stat("connection:inprogress", -1)
-			s.counter.Stat("connection:error", 1)
-		}
-	}()
-
-	s.counter.Stat("connection:inprogress", 1)
-	id, err := shortid.Generate()
-	if err != nil {
-		log.Println("ERROR: failed to generate uid due to", err)
-		return
-	}
-	var sendName string
-	if s.sendSize == 0 {
-		sendName = id
-	} else {
-		sendName = RandStringBytesMaskImprSrc(s.sendSize)
+	if s.service != nil {
+		return s.baseConnect(protocol, s.serviceTokenDial)
 	}
+	return s.baseConnect(protocol, s.serviceDial)
+}
 
-	negotiateResponse, err := http.Get("http://" + s.host + "/negotiate")
+// serviceDial negotiates with the app server and connects to the service URL it returns.
+// The error is logged and counted to errorGroup.
+func (s *SignalrCoreCommon) serviceDial(id string, errorGroup string) (Transport, error) {
+	negotiateStart := time.Now()
+	negotiateURL := "http://" + s.host + "/negotiate"
+	if s.useWss {
+		negotiateURL = "https://" + s.host + "/negotiate"
+	}
+	negotiateResponse, err := s.httpClient.Get(negotiateURL)
 	if err != nil {
-		s.LogError("connection:error", id, "Failed to negotiate with the server", err)
-		return
+		s.LogError(errorGroup, id, "Failed to negotiate with the server", err)
+		return nil, err
 	}
 	defer negotiateResponse.Body.Close()
 
@@ -160,50 +247,20 @@ func (s *SignalrCoreCommon) SignalrServiceBaseConnect(protocol string) (session
 	var handshake SignalrServiceHandshake
 	err = decoder.Decode(&handshake)
 	if err != nil {
-		s.LogError("connection:error", id, "Failed to decode service URL and jwtBearer", err)
-		return
+		s.LogError(errorGroup, id, "Failed to decode service URL and jwtBearer", err)
+		return nil, err
 	}
+	s.LogDuration(ConnectNegotiate, time.Since(negotiateStart))
 
 	baseURL := strings.Replace(handshake.ServiceUrl, "http", "ws", 1)
 	wsURL := baseURL + "&access_token=" + handshake.JwtBearer
 
-	dialer := &websocket.Dialer{
-		NetDial: func(network, addr string) (net.Conn, error) {
-			start := time.Now()
-
-			conn, err := net.Dial(network, addr)
-
-			duration := time.Now().Sub(start) / time.Millisecond
-			s.LogLatency("dial", int64(duration))
-
-			if conn != nil {
-				if e := conn.(*net.TCPConn).SetLinger(0); e != nil {
-					log.Println("Fail to set linger", e)
-				}
-			}
-
-			return conn, err
-		},
-		Proxy:            http.ProxyFromEnvironment,
-		HandshakeTimeout: 45 * time.Second,
-	}
-	c, _, err := dialer.Dial(wsURL, nil)
+	c, err := s.dialWebSocket(wsURL, s.tlsConfig, s.sourceAddrs)
 	if err != nil {
-		s.LogError("connection:error", id, "Failed to connect to websocket", err)
-		return
-	}
-	session = NewSession(id, sendName, s.received, s.counter, c)
-	if session != nil {
-		s.counter.Stat("connection:inprogress", -1)
-		s.counter.Stat("connection:established", 1)
-
-		session.Start()
-		session.NegotiateProtocol(protocol)
-		return
+		s.LogError(errorGroup, id, "Failed to connect to websocket", err)
+		return nil, err
 	}
-
-	err = fmt.Errorf("Nil session")
-	return
+	return c, nil
 }
 
 func (s *SignalrCoreCommon) SignalrServiceJsonConnect() (session *Session, err error) {
@@ -217,6 +274,12 @@ func (s *SignalrCoreCommon) SignalrServiceMsgPackConnect() (session *Session, er
 var numBitsToShift = []uint{0, 7, 14, 21, 28}
 
 func (s *SignalrCoreCommon) ParseBinaryMessage(bytes []byte) ([]byte, error) {
+	msg, _, err := splitBinaryMessage(bytes)
+	return msg, err
+}
+
+// splitBinaryMessage returns the first length-prefixed message of the frame and the rest of the frame.
+func splitBinaryMessage(bytes []byte) ([]byte, []byte, error) {
 	moreBytes := true
 	msgLen := 0
 	numBytes := 0
@@ -228,34 +291,107 @@ func (s *SignalrCoreCommon) ParseBinaryMessage(bytes []byte) ([]byte, error) {
 	}
 
 	if msgLen+numBytes > len(bytes) {
-		return nil, fmt.Errorf("Not enough data in message, message length = %d, length section bytes = %d, data length = %d", msgLen, numBytes, len(bytes))
+		return nil, nil, fmt.Errorf("Not enough data in message, message length = %d, length section bytes = %d, data length = %d", msgLen, numBytes, len(bytes))
 	}
 
-	return bytes[numBytes : numBytes+msgLen], nil
+	return bytes[numBytes : numBytes+msgLen], bytes[numBytes+msgLen:], nil
 }
 
-func (s *SignalrCoreCommon) ProcessJsonLatency(p ProtocolProcessing, content SignalRCoreInvocation, recvSize int64) bool {
+// latencyArgumentSubject is implemented by the subjects whose stamp is not the second argument
+// of the latency check target.
+type latencyArgumentSubject interface {
+	LatencyArgument() int
+}
+
+// stampArgument returns the argument of the stamp, or false if there is not or it is not a string.
+func stampArgument(p ProtocolProcessing, arguments []interface{}) (string, bool) {
+	index := 1
+	if l, ok := p.(latencyArgumentSubject); ok {
+		index = l.LatencyArgument()
+	}
+	if index < 0 || index >= len(arguments) {
+		return "", false
+	}
+	stamp, ok := arguments[index].(string)
+	return stamp, ok
+}
+
+func (s *SignalrCoreCommon) ProcessJsonLatency(p ProtocolProcessing, clientID string, content SignalRCoreInvocation, recvSize int64) bool {
 	if content.Type == 1 && content.Target == p.LatencyCheckTarget() {
-		sendStart, err := strconv.ParseInt(content.Arguments[1], 10, 64)
-		if err != nil {
-			s.LogError("message:decode_error", "", "Failed to decode start timestamp", err)
+		stamp, ok := stampArgument(p, content.Arguments)
+		if !ok {
+			s.LogError("message:decode_error", clientID, "Failed to find the stamp argument", fmt.Errorf("%d arguments", len(content.Arguments)))
 			return false
 		}
-		s.counter.Stat("message:received", 1)
-		s.counter.Stat("message:recvSize", recvSize)
-		s.LogLatency("message", (time.Now().UnixNano()-sendStart)/1000000)
-		return true
+		return s.processLatency(clientID, stamp, recvSize)
 	}
 	return false
 }
 
-func (s *SignalrCoreCommon) ProcessJsonJoinLeaveGroup(p ProtocolProcessing, content SignalRCoreInvocation, recvSize int64) bool {
+// processLatency records the latency of a message with the stamp, and checks its sequence from the sender.
+func (s *SignalrCoreCommon) processLatency(clientID string, stamp string, recvSize int64) bool {
+	sendStart, sender, sequence, err := parseStamp(stamp)
+	if err != nil {
+		s.LogError("message:decode_error", clientID, "Failed to decode start timestamp", err)
+		return false
+	}
+	s.registry.Counter("message:received").Add(1)
+	s.registry.Counter("message:recvSize").Add(recvSize)
+	s.LogSize("message:received", recvSize)
+	s.LogLatency("message", (util.Now().UnixNano()-sendStart)/int64(time.Microsecond))
+	if sender != "" {
+		result := s.sequences.track(sender, clientID, sequence)
+		s.registry.Counter("message:lost").Add(result.lost)
+		s.registry.Counter("message:duplicate").Add(result.duplicate)
+		s.registry.Counter("message:out_of_order").Add(result.outOfOrder)
+	}
+	return true
+}
+
+// processCompletion records the latency from a blocking invocation to its completion, and counts the error completions.
+// The completions of the streams and the uploads are passed to processStreamCompletion and processUploadCompletion.
+func (s *SignalrCoreCommon) processCompletion(clientID string, invocationID string, errorText string) {
+	if s.processStreamCompletion(clientID, invocationID, errorText) || s.processUploadCompletion(clientID, invocationID, errorText) {
+		return
+	}
+	if s.invocations == nil || invocationID == "" {
+		return
+	}
+	var sendTime time.Time
+	id, err := strconv.ParseInt(invocationID, 10, 64)
+	ok := err == nil
+	if ok {
+		sendTime, ok = s.invocations.complete(clientID, id)
+	}
+	if !ok {
+		// timed out already, or not invoked by us
+		s.registry.Counter("invocation:unknown_completion").Add(1)
+		return
+	}
+	s.registry.Gauge("invocation:outstanding").Add(-1)
+	s.LogDuration("invocation:completion", util.Now().Sub(sendTime))
+	if errorText != "" {
+		s.LogError("invocation:error", clientID, "Invocation "+invocationID+" failed", errors.New(errorText))
+	} else {
+		s.registry.Counter("invocation:completed").Add(1)
+	}
+}
+
+// processClose counts the Close message of the server and logs its error.
+func (s *SignalrCoreCommon) processClose(clientID string, errorText string) {
+	s.registry.Counter("connection:server_close").Add(1)
+	if errorText != "" {
+		s.LogError("connection:server_close_error", clientID, "Server closed the connection", errors.New(errorText))
+	}
+}
+
+func (s *SignalrCoreCommon) ProcessJsonJoinLeaveGroup(p ProtocolProcessing, clientID string, content SignalRCoreInvocation, recvSize int64) bool {
 	if content.Type == 1 {
 		if content.Target == p.JoinGroupTarget() {
-			s.counter.Stat("connection:groupjoin", 1)
+			s.registry.Gauge("connection:groupjoin").Add(1)
 			return true
 		} else if content.Target == p.LeaveGroupTarget() {
-			s.counter.Stat("connection:groupjoin", -1)
+			s.registry.Gauge("connection:groupjoin").Add(-1)
 			return true
 		}
 	}
@@ -280,7 +416,38 @@ func (s *SignalrCoreCommon) ProcessJson(p ProtocolProcessing) {
 				continue
 			}
 
-			// ignore ping
+			if common.Type == 3 {
+				var completion SignalRCoreCompletion
+				if err = json.Unmarshal(msg, &completion); err != nil {
+					s.LogError("message:decode_error", msgReceived.ClientID, "Failed to decode incoming SignalR completion message", err)
+					continue
+				}
+				s.processCompletion(msgReceived.ClientID, completion.InvocationId, completion.Error)
+				continue
+			}
+			if common.Type == 2 {
+				var item SignalRCoreStreamItem
+				if err = json.Unmarshal(msg, &item); err != nil {
+					s.LogError("message:decode_error", msgReceived.ClientID, "Failed to decode incoming SignalR stream item", err)
+					continue
+				}
+				s.processStreamItem(msgReceived.ClientID, item.InvocationId)
+				continue
+			}
+
+			if common.Type == 6 {
+				s.registry.Counter("ping:received").Add(1)
+				continue
+			}
+			if common.Type == 7 {
+				var closeMessage SignalRCoreClose
+				if err = json.Unmarshal(msg, &closeMessage); err != nil {
+					s.LogError("message:decode_error", msgReceived.ClientID, "Failed to decode incoming SignalR close message", err)
+					continue
+				}
+				s.processClose(msgReceived.ClientID, closeMessage.Error)
+				continue
+			}
 			if common.Type != 1 {
 				continue
 			}
@@ -292,34 +459,31 @@ func (s *SignalrCoreCommon) ProcessJson(p ProtocolProcessing) {
 				continue
 			}
 			for _, recvFunc := range s.JsonReceiveFuncs {
-				recvFunc(p, content, int64(len(msg)))
+				recvFunc(p, msgReceived.ClientID, content, int64(len(msg)))
 			}
 		}
 	}
 }
 
-func (s *SignalrCoreCommon) ProcessMsgPackLatency(p ProtocolProcessing, content MsgpackInvocation, recvSize int64) bool {
+func (s *SignalrCoreCommon) ProcessMsgPackLatency(p ProtocolProcessing, clientID string, content MsgpackInvocation, recvSize int64) bool {
 	if content.MessageType == 1 && content.Target == p.LatencyCheckTarget() {
-		sendStart, err := strconv.ParseInt(content.Params[1], 10, 64)
-		if err != nil {
-			s.LogError("message:decode_error", "", "Failed to decode start timestamp", err)
+		stamp, ok := stampArgument(p, content.Params)
+		if !ok {
+			s.LogError("message:decode_error", clientID, "Failed to find the stamp argument", fmt.Errorf("%d arguments", len(content.Params)))
 			return false
 		}
-		s.counter.Stat("message:received", 1)
-		s.counter.Stat("message:recvSize", recvSize)
-		s.LogLatency("message", (time.Now().UnixNano()-sendStart)/1000000)
-		return true
+		return s.processLatency(clientID, stamp, recvSize)
 	}
 	return true
 }
 
-func (s *SignalrCoreCommon) ProcessMsgPackJoinLeaveGroup(p ProtocolProcessing, content MsgpackInvocation, recvSize int64) bool {
+func (s *SignalrCoreCommon) ProcessMsgPackJoinLeaveGroup(p ProtocolProcessing, clientID string, content MsgpackInvocation, recvSize int64) bool {
 	if content.MessageType == 1 {
 		if content.Target == p.JoinGroupTarget() {
-			s.counter.Stat("message:groupjoin", 1)
+			s.registry.Gauge("message:groupjoin").Add(1)
 			return true
 		} else if content.Target == p.LeaveGroupTarget() {
-			s.counter.Stat("message:groupjoin", -1)
+			s.registry.Gauge("message:groupjoin").Add(-1)
 			return true
 		}
 	}
@@ -328,22 +492,44 @@ func (s *SignalrCoreCommon) ProcessMsgPackJoinLeaveGroup(p ProtocolProcessing, c
 
 func (s *SignalrCoreCommon) ProcessMsgPack(p ProtocolProcessing) {
 	for msgReceived := range s.received {
-		msg, err := s.ParseBinaryMessage(msgReceived.Content)
-		if err != nil {
-			s.LogError("message:decode_error", msgReceived.ClientID, "Failed to parse incoming message", err)
-			continue
-		}
-		var content MsgpackInvocation
-		err = msgpack.Unmarshal(msg, &content)
-		if err != nil {
-			s.LogError("message:decode_error", msgReceived.ClientID, "Failed to decode incoming message", err)
-			continue
-		}
-
-		for _, recvFunc := range s.MsgpackReceiveFuncs {
-			if recvFunc(p, content, int64(len(msgReceived.Content))) {
+		// Multiple messages, each prefixed with its length, may be merged to be a frame.
+		for data := msgReceived.Content; len(data) > 0; {
+			msg, rest, err := splitBinaryMessage(data)
+			if err != nil {
+				s.LogError("message:decode_error", msgReceived.ClientID, "Failed to parse incoming message", err)
 				break
 			}
+			size := int64(len(data) - len(rest))
+			data = rest
+
+			var content MsgpackInvocation
+			err = msgpack.Unmarshal(msg, &content)
+			if err != nil {
+				s.LogError("message:decode_error", msgReceived.ClientID, "Failed to decode incoming message", err)
+				continue
+			}
+			if content.MessageType == 3 {
+				s.processCompletion(msgReceived.ClientID, content.InvocationID, content.Error)
+				continue
+			}
+			if content.MessageType == 2 {
+				s.processStreamItem(msgReceived.ClientID, content.InvocationID)
+				continue
+			}
+			if content.MessageType == 6 {
+				s.registry.Counter("ping:received").Add(1)
+				continue
+			}
+			if content.MessageType == 7 {
+				s.processClose(msgReceived.ClientID, content.Error)
+				continue
+			}
+
+			for _, recvFunc := range s.MsgpackReceiveFuncs {
+				if recvFunc(p, msgReceived.ClientID, content, size) {
+					break
+				}
+			}
 		}
 	}
 }
@@ -3,7 +3,6 @@ package benchmark
 import (
 	"encoding/json"
 	"log"
-	"strconv"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -22,22 +21,61 @@ type SignalRCommon struct {
 }
 
 type SignalRCoreInvocation struct {
-	Type      int      `json:"type"`
-	Target    string   `json:"target"`
-	Arguments []string `json:"arguments"`
+	Type int `json:"type"`
+	// InvocationId is set if the invocation is blocking, i.e. it waits for a Completion with the same ID.
+	InvocationId string        `json:"invocationId,omitempty"`
+	Target       string        `json:"target"`
+	Arguments    []interface{} `json:"arguments"`
+	// StreamIds are the IDs of the streams uploaded to the stream parameters of the target.
+	StreamIds []string `json:"streamIds,omitempty"`
+}
+
+// SignalRCoreCompletion is the result of a blocking invocation. The result itself is not used.
+type SignalRCoreCompletion struct {
+	Type         int    `json:"type"`
+	InvocationId string `json:"invocationId"`
+	Error        string `json:"error,omitempty"`
+}
+
+// SignalRCoreClose is sent by the server before it closes the connection, with the error if any.
+type SignalRCoreClose struct {
+	Type           int    `json:"type"`
+	Error          string `json:"error"`
+	AllowReconnect bool   `json:"allowReconnect"`
 }
 
+// MsgpackInvocation is an invocation, a Completion whose ResultKind and Error are set, a StreamItem, a Ping
+// or a Close whose Error is set.
 type MsgpackInvocation struct {
 	MessageType  int32
 	Header       map[string]string
 	InvocationID string
 	Target       string
-	Params       []string
+	Params       []interface{}
+	StreamIDs    []string
+	ResultKind   int32
+	Error        string
 }
 
 func (m *MsgpackInvocation) EncodeMsgpack(enc *msgpack.Encoder) error {
-	enc.EncodeArrayLen(4)
-	return enc.Encode(m.MessageType, m.Header, m.InvocationID, m.Target, m.Params)
+	if len(m.StreamIDs) > 0 {
+		enc.EncodeArrayLen(6)
+	} else {
+		enc.EncodeArrayLen(5)
+	}
+	if err := enc.Encode(m.MessageType, m.Header); err != nil {
+		return err
+	}
+	// the invocation ID is nil for the non-blocking invocations
+	if m.InvocationID == "" {
+		enc.EncodeNil()
+	} else {
+		enc.EncodeString(m.InvocationID)
+	}
+	if len(m.StreamIDs) > 0 {
+		return enc.Encode(m.Target, m.Params, m.StreamIDs)
+	}
+	return enc.Encode(m.Target, m.Params)
 }
 
 func (m *MsgpackInvocation) DecodeMsgpack(dec *msgpack.Decoder) error {
@@ -48,8 +86,28 @@ func (m *MsgpackInvocation) DecodeMsgpack(dec *msgpack.Decoder) error {
 		return err
 	}
 	m.MessageType = messageType
-	if messageType == 1 {
+	switch messageType {
+	case 1:
 		return dec.Decode(&m.Header, &m.InvocationID, &m.Target, &m.Params)
+	case 2:
+		// the item of the stream is not used
+		if err = dec.Decode(&m.Header, &m.InvocationID); err != nil {
+			return err
+		}
+		return dec.Skip()
+	case 3:
+		if err = dec.Decode(&m.Header, &m.InvocationID, &m.ResultKind); err != nil {
+			return err
+		}
+		switch m.ResultKind {
+		case completionError:
+			return dec.Decode(&m.Error)
+		case completionResult:
+			return dec.Skip()
+		}
+	case 7:
+		// the error is nil if the connection is closed normally
+		return dec.Decode(&m.Error)
 	}
 	return nil
 }
@@ -80,11 +138,24 @@ func appendLength(bytes []byte) []byte {
 	return buffer
 }
 
-func GenerateJsonRequest(target string, arguments []string) Message {
+func GenerateJsonRequest(target string, arguments []interface{}) Message {
+	return GenerateJsonInvocation("", target, arguments)
+}
+
+// GenerateJsonInvocation generates an invocation, which is blocking if invocationID is not empty.
+func GenerateJsonInvocation(invocationID string, target string, arguments []interface{}) Message {
+	return GenerateJsonUploadInvocation(invocationID, target, arguments, nil)
+}
+
+// GenerateJsonUploadInvocation generates an invocation with the streams streamIDs uploaded to it, whose items
+// and completions follow.
+func GenerateJsonUploadInvocation(invocationID string, target string, arguments []interface{}, streamIDs []string) Message {
 	msg, err := json.Marshal(&SignalRCoreInvocation{
-		Type:      1,
-		Target:    target,
-		Arguments: arguments,
+		Type:         1,
+		InvocationId: invocationID,
+		Target:       target,
+		Arguments:    arguments,
+		StreamIds:    streamIDs,
 	})
 	if err != nil {
 		log.Println("ERROR: failed to encoding SignalR message", err)
@@ -94,12 +165,25 @@ func GenerateJsonRequest(target string, arguments []string) Message {
 	return PlainMessage{websocket.TextMessage, msg}
 }
 
-func GenerateMessagePackRequest(target string, arguments []string) Message {
+func GenerateMessagePackRequest(target string, arguments []interface{}) Message {
+	return GenerateMessagePackInvocation("", target, arguments)
+}
+
+// GenerateMessagePackInvocation generates an invocation, which is blocking if invocationID is not empty.
+func GenerateMessagePackInvocation(invocationID string, target string, arguments []interface{}) Message {
+	return GenerateMessagePackUploadInvocation(invocationID, target, arguments, nil)
+}
+
+// GenerateMessagePackUploadInvocation generates an invocation with the streams streamIDs uploaded to it, whose
+// items and completions follow.
+func GenerateMessagePackUploadInvocation(invocationID string, target string, arguments []interface{}, streamIDs []string) Message {
 	invocation := MsgpackInvocation{
-		MessageType: 1,
-		Header:      map[string]string{},
-		Target:      target,
-		Params:      arguments,
+		MessageType:  1,
+		Header:       map[string]string{},
+		InvocationID: invocationID,
+		Target:       target,
+		Params:       arguments,
+		StreamIDs:    streamIDs,
 	}
 	msg, err := msgpack.Marshal(&invocation)
 	if err != nil {
@@ -110,6 +194,33 @@ func GenerateMessagePackRequest(target string, arguments []string) Message {
 	return PlainMessage{websocket.BinaryMessage, msg}
 }
 
+// GenerateJsonStreamItem generates an item of the uploaded stream.
+func GenerateJsonStreamItem(streamID string, item string) Message {
+	return generateJson(&SignalRCoreStreamItem{
+		Type:         2,
+		InvocationId: streamID,
+		Item:         item,
+	})
+}
+
+// GenerateJsonStreamCompletion generates the completion of the uploaded stream.
+func GenerateJsonStreamCompletion(streamID string) Message {
+	return generateJson(&SignalRCoreCompletion{
+		Type:         3,
+		InvocationId: streamID,
+	})
+}
+
+// GenerateMessagePackStreamItem generates an item of the uploaded stream.
+func GenerateMessagePackStreamItem(streamID string, item string) Message {
+	return generateMessagePack(2, map[string]string{}, streamID, item)
+}
+
+// GenerateMessagePackStreamCompletion generates the completion of the uploaded stream, without a result.
+func GenerateMessagePackStreamCompletion(streamID string) Message {
+	return generateMessagePack(3, map[string]string{}, streamID, completionVoid)
+}
+
 type SignalRCoreTextMessageGenerator struct {
 	WithInterval
 	Target string
@@ -117,12 +228,9 @@ type SignalRCoreTextMessageGenerator struct {
 
 var _ MessageGenerator = (*SignalRCoreTextMessageGenerator)(nil)
 
-func (g *SignalRCoreTextMessageGenerator) Generate(uid string, groupName string, invocationId int64) Message {
-	arguments := []string{
-		uid,
-		strconv.FormatInt(time.Now().UnixNano(), 10),
-	}
-	return GenerateJsonRequest(g.Target, arguments)
+func (g *SignalRCoreTextMessageGenerator) Generate(session *Session, sendTime time.Time) Message {
+	arguments := withPayload(session, true, session.SendName, formatStamp(sendTime, session.ID, session.invocationId))
+	return GenerateJsonInvocation(session.blockingInvocationID(), g.Target, arguments)
 }
 
 type JsonGroupSendMessageGenerator struct {
@@ -132,12 +240,9 @@ type JsonGroupSendMessageGenerator struct {
 
 var _ MessageGenerator = (*JsonGroupSendMessageGenerator)(nil)
 
-func (g *JsonGroupSendMessageGenerator) Generate(uid string, groupName string, invocationId int64) Message {
-	arguments := []string{
-		groupName,
-		strconv.FormatInt(time.Now().UnixNano(), 10),
-	}
-	return GenerateJsonRequest(g.Target, arguments)
+func (g *JsonGroupSendMessageGenerator) Generate(session *Session, sendTime time.Time) Message {
+	arguments := withPayload(session, true, session.GroupName, formatStamp(sendTime, session.ID, session.invocationId))
+	return GenerateJsonInvocation(session.blockingInvocationID(), g.Target, arguments)
 }
 
 type MessagePackMessageGenerator struct {
@@ -147,12 +252,9 @@ type MessagePackMessageGenerator struct {
 
 var _ MessageGenerator = (*MessagePackMessageGenerator)(nil)
 
-func (g *MessagePackMessageGenerator) Generate(uid string, groupName string, invocationId int64) Message {
-	params := []string{
-		uid,
-		strconv.FormatInt(time.Now().UnixNano(), 10),
-	}
-	return GenerateMessagePackRequest(g.Target, params)
+func (g *MessagePackMessageGenerator) Generate(session *Session, sendTime time.Time) Message {
+	params := withPayload(session, false, session.SendName, formatStamp(sendTime, session.ID, session.invocationId))
+	return GenerateMessagePackInvocation(session.blockingInvocationID(), g.Target, params)
 }
 
 type MessagePackGroupSendMessageGenerator struct {
@@ -162,10 +264,15 @@ type MessagePackGroupSendMessageGenerator struct {
 
 var _ MessageGenerator = (*MessagePackGroupSendMessageGenerator)(nil)
 
-func (g *MessagePackGroupSendMessageGenerator) Generate(uid string, groupName string, invocationId int64) Message {
-	params := []string{
-		groupName,
-		strconv.FormatInt(time.Now().UnixNano(), 10),
+func (g *MessagePackGroupSendMessageGenerator) Generate(session *Session, sendTime time.Time) Message {
+	params := withPayload(session, false, session.GroupName, formatStamp(sendTime, session.ID, session.invocationId))
+	return GenerateMessagePackInvocation(session.blockingInvocationID(), g.Target, params)
+}
+
+// withPayload returns the arguments followed by the payload of the next message of the session, if any.
+func withPayload(session *Session, jsonProtocol bool, arguments ...interface{}) []interface{} {
+	if payload := payloadArgument(session.payload.Next(), jsonProtocol); payload != nil {
+		arguments = append(arguments, payload)
 	}
-	return GenerateMessagePackRequest(g.Target, params)
+	return arguments
 }
@@ -20,6 +20,10 @@ func (s *SignalrCoreJsonBroadcast) IsMsgpack() bool {
 	return false
 }
 
+func (s *SignalrCoreJsonBroadcast) FanOut() int {
+	return FanOutBroadcast
+}
+
 func (s *SignalrCoreJsonBroadcast) Name() string {
 	return "SignalR Core Connection"
 }
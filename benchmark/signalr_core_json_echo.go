@@ -36,6 +36,10 @@ func (s *SignalrCoreJsonEcho) DoGroupSend(clients int, intervalMillis int) error
 	return nil
 }
 
+func (s *SignalrCoreJsonEcho) DoGroupSendRate(clients int, rate int) error {
+	return nil
+}
+
 func (s *SignalrCoreJsonEcho) DoSend(clients int, intervalMillis int) error {
 	return s.doSend(clients, intervalMillis, &SignalRCoreTextMessageGenerator{
 		WithInterval: WithInterval{
@@ -45,6 +49,12 @@ func (s *SignalrCoreJsonEcho) DoSend(clients int, intervalMillis int) error {
 	})
 }
 
+func (s *SignalrCoreJsonEcho) DoSendRate(clients int, rate int) error {
+	return s.doSendRate(clients, rate, &SignalRCoreTextMessageGenerator{
+		Target: s.LatencyCheckTarget(),
+	})
+}
+
 func (s *SignalrCoreJsonEcho) DoJoinGroup(membersPerGroup int) error {
 	return nil
 }
@@ -0,0 +1,73 @@
+package benchmark
+
+var _ Subject = (*SignalrCoreJsonStreaming)(nil)
+
+// SignalrCoreJsonStreaming starts streams from the hub method StreamTarget(count, delay), which streams
+// count items every delay milliseconds like the Counter of the ASP.NET Core SignalR samples, and uploads
+// streams to the hub method UploadTarget(stream).
+type SignalrCoreJsonStreaming struct {
+	SignalrCoreCommon
+}
+
+func (s *SignalrCoreJsonStreaming) StreamTarget() string {
+	return "Counter"
+}
+
+func (s *SignalrCoreJsonStreaming) UploadTarget() string {
+	return "UploadStream"
+}
+
+func (s *SignalrCoreJsonStreaming) IsJson() bool {
+	return true
+}
+
+func (s *SignalrCoreJsonStreaming) IsMsgpack() bool {
+	return false
+}
+
+func (s *SignalrCoreJsonStreaming) Name() string {
+	return "SignalR Core JSON Streaming"
+}
+
+func (s *SignalrCoreJsonStreaming) DoEnsureConnection(count int, conPerSec int) error {
+	return s.doEnsureConnection(count, conPerSec, func(withSessions *WithSessions) (*Session, error) {
+		return s.SignalrCoreJsonConnect()
+	})
+}
+
+func (s *SignalrCoreJsonStreaming) DoSend(clients int, intervalMillis int) error {
+	return nil
+}
+
+func (s *SignalrCoreJsonStreaming) DoSendRate(clients int, rate int) error {
+	return nil
+}
+
+func (s *SignalrCoreJsonStreaming) DoGroupSend(clients int, intervalMillis int) error {
+	return nil
+}
+
+func (s *SignalrCoreJsonStreaming) DoGroupSendRate(clients int, rate int) error {
+	return nil
+}
+
+func (s *SignalrCoreJsonStreaming) DoJoinGroup(membersPerGroup int) error {
+	return nil
+}
+
+// DoStream starts streams streams of items items every intervalMillis on each of clients connections.
+func (s *SignalrCoreJsonStreaming) DoStream(clients int, streams int, items int, intervalMillis int) error {
+	return s.doStream(clients, streams, func(invocationID string) Message {
+		return GenerateJsonStreamInvocation(invocationID, s.StreamTarget(), []interface{}{items, intervalMillis})
+	})
+}
+
+// DoCancelStream cancels streams of the active streams.
+func (s *SignalrCoreJsonStreaming) DoCancelStream(streams int) error {
+	return s.doCancelStream(streams, GenerateJsonCancelInvocation)
+}
+
+// DoUpload uploads a stream of items items of size bytes at rate items per second from each of clients connections.
+func (s *SignalrCoreJsonStreaming) DoUpload(clients int, items int, rate int, size int) error {
+	return s.doUpload(clients, items, rate, size, s.UploadTarget(), jsonUploadProtocol)
+}
@@ -19,6 +19,10 @@ func (s *SignalrCoreMsgpackBroadcast) IsMsgpack() bool {
 	return true
 }
 
+func (s *SignalrCoreMsgpackBroadcast) FanOut() int {
+	return FanOutBroadcast
+}
+
 func (s *SignalrCoreMsgpackBroadcast) Name() string {
 	return "SignalR Core MessagePack"
 }
@@ -40,6 +40,10 @@ func (s *SignalrCoreMsgpackEcho) DoGroupSend(clients int, intervalMillis int) er
 	return nil
 }
 
+func (s *SignalrCoreMsgpackEcho) DoGroupSendRate(clients int, rate int) error {
+	return nil
+}
+
 func (s *SignalrCoreMsgpackEcho) DoSend(clients int, intervalMillis int) error {
 	return s.doSend(clients, intervalMillis, &MessagePackMessageGenerator{
 		WithInterval: WithInterval{
@@ -48,3 +52,9 @@ func (s *SignalrCoreMsgpackEcho) DoSend(clients int, intervalMillis int) error {
 		Target: s.LatencyCheckTarget(),
 	})
 }
+
+func (s *SignalrCoreMsgpackEcho) DoSendRate(clients int, rate int) error {
+	return s.doSendRate(clients, rate, &MessagePackMessageGenerator{
+		Target: s.LatencyCheckTarget(),
+	})
+}
@@ -0,0 +1,73 @@
+package benchmark
+
+var _ Subject = (*SignalrCoreMsgpackStreaming)(nil)
+
+// SignalrCoreMsgpackStreaming starts streams from the hub method StreamTarget(count, delay), which streams
+// count items every delay milliseconds like the Counter of the ASP.NET Core SignalR samples, and uploads
+// streams to the hub method UploadTarget(stream).
+type SignalrCoreMsgpackStreaming struct {
+	SignalrCoreCommon
+}
+
+func (s *SignalrCoreMsgpackStreaming) StreamTarget() string {
+	return "Counter"
+}
+
+func (s *SignalrCoreMsgpackStreaming) UploadTarget() string {
+	return "UploadStream"
+}
+
+func (s *SignalrCoreMsgpackStreaming) IsJson() bool {
+	return false
+}
+
+func (s *SignalrCoreMsgpackStreaming) IsMsgpack() bool {
+	return true
+}
+
+func (s *SignalrCoreMsgpackStreaming) Name() string {
+	return "SignalR Core MsgPack Streaming"
+}
+
+func (s *SignalrCoreMsgpackStreaming) DoEnsureConnection(count int, conPerSec int) error {
+	return s.doEnsureConnection(count, conPerSec, func(withSessions *WithSessions) (*Session, error) {
+		return s.SignalrCoreMsgPackConnect()
+	})
+}
+
+func (s *SignalrCoreMsgpackStreaming) DoSend(clients int, intervalMillis int) error {
+	return nil
+}
+
+func (s *SignalrCoreMsgpackStreaming) DoSendRate(clients int, rate int) error {
+	return nil
+}
+
+func (s *SignalrCoreMsgpackStreaming) DoGroupSend(clients int, intervalMillis int) error {
+	return nil
+}
+
+func (s *SignalrCoreMsgpackStreaming) DoGroupSendRate(clients int, rate int) error {
+	return nil
+}
+
+func (s *SignalrCoreMsgpackStreaming) DoJoinGroup(membersPerGroup int) error {
+	return nil
+}
+
+// DoStream starts streams streams of items items every intervalMillis on each of clients connections.
+func (s *SignalrCoreMsgpackStreaming) DoStream(clients int, streams int, items int, intervalMillis int) error {
+	return s.doStream(clients, streams, func(invocationID string) Message {
+		return GenerateMessagePackStreamInvocation(invocationID, s.StreamTarget(), []interface{}{items, intervalMillis})
+	})
+}
+
+// DoCancelStream cancels streams of the active streams.
+func (s *SignalrCoreMsgpackStreaming) DoCancelStream(streams int) error {
+	return s.doCancelStream(streams, GenerateMessagePackCancelInvocation)
+}
+
+// DoUpload uploads a stream of items items of size bytes at rate items per second from each of clients connections.
+func (s *SignalrCoreMsgpackStreaming) DoUpload(clients int, items int, rate int, size int) error {
+	return s.doUpload(clients, items, rate, size, s.UploadTarget(), msgpackUploadProtocol)
+}
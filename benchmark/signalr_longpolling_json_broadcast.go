@@ -0,0 +1,18 @@
+package benchmark
+
+var _ Subject = (*SignalrLongPollingJsonBroadcast)(nil)
+
+// SignalrLongPollingJsonBroadcast is SignalrCoreJsonBroadcast over the long polling transport.
+type SignalrLongPollingJsonBroadcast struct {
+	SignalrCoreJsonBroadcast
+}
+
+func (s *SignalrLongPollingJsonBroadcast) Name() string {
+	return "SignalR Long Polling JSON Broadcast"
+}
+
+func (s *SignalrLongPollingJsonBroadcast) DoEnsureConnection(count int, conPerSec int) error {
+	return s.doEnsureConnection(count, conPerSec, func(withSessions *WithSessions) (*Session, error) {
+		return s.SignalrLongPollingConnect("json")
+	})
+}
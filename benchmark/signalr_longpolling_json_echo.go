@@ -0,0 +1,18 @@
+package benchmark
+
+var _ Subject = (*SignalrLongPollingJsonEcho)(nil)
+
+// SignalrLongPollingJsonEcho is SignalrCoreJsonEcho over the long polling transport.
+type SignalrLongPollingJsonEcho struct {
+	SignalrCoreJsonEcho
+}
+
+func (s *SignalrLongPollingJsonEcho) Name() string {
+	return "SignalR Long Polling JSON Echo"
+}
+
+func (s *SignalrLongPollingJsonEcho) DoEnsureConnection(count int, conPerSec int) error {
+	return s.doEnsureConnection(count, conPerSec, func(withSessions *WithSessions) (*Session, error) {
+		return s.SignalrLongPollingConnect("json")
+	})
+}
@@ -0,0 +1,18 @@
+package benchmark
+
+var _ Subject = (*SignalrLongPollingMsgpackBroadcast)(nil)
+
+// SignalrLongPollingMsgpackBroadcast is SignalrCoreMsgpackBroadcast over the long polling transport.
+type SignalrLongPollingMsgpackBroadcast struct {
+	SignalrCoreMsgpackBroadcast
+}
+
+func (s *SignalrLongPollingMsgpackBroadcast) Name() string {
+	return "SignalR Long Polling MessagePack Broadcast"
+}
+
+func (s *SignalrLongPollingMsgpackBroadcast) DoEnsureConnection(count int, conPerSec int) error {
+	return s.doEnsureConnection(count, conPerSec, func(withSessions *WithSessions) (*Session, error) {
+		return s.SignalrLongPollingConnect("messagepack")
+	})
+}
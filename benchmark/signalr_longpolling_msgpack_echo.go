@@ -0,0 +1,18 @@
+package benchmark
+
+var _ Subject = (*SignalrLongPollingMsgpackEcho)(nil)
+
+// SignalrLongPollingMsgpackEcho is SignalrCoreMsgpackEcho over the long polling transport.
+type SignalrLongPollingMsgpackEcho struct {
+	SignalrCoreMsgpackEcho
+}
+
+func (s *SignalrLongPollingMsgpackEcho) Name() string {
+	return "SignalR Long Polling MessagePack Echo"
+}
+
+func (s *SignalrLongPollingMsgpackEcho) DoEnsureConnection(count int, conPerSec int) error {
+	return s.doEnsureConnection(count, conPerSec, func(withSessions *WithSessions) (*Session, error) {
+		return s.SignalrLongPollingConnect("messagepack")
+	})
+}
@@ -0,0 +1,148 @@
+package benchmark
+
+import (
+	"fmt"
+	"time"
+)
+
+var _ Subject = (*SignalrScenario)(nil)
+
+// SignalrScenario benchmarks the SignalR hub defined by the scenario of the config, see Scenario.
+type SignalrScenario struct {
+	SignalrCoreCommon
+	scenario *Scenario
+}
+
+func (s *SignalrScenario) Setup(config *Config, p ProtocolProcessing) error {
+	if config.Scenario == nil {
+		return fmt.Errorf("No scenario is defined, start the master with --scenario")
+	}
+	// the scenario is needed by the protocol processing of the common setup
+	s.scenario = config.Scenario
+	if err := s.SignalrCoreCommon.Setup(config, p); err != nil {
+		return err
+	}
+	s.host = config.Host + s.scenario.Path
+	return nil
+}
+
+func (s *SignalrScenario) LatencyCheckTarget() string {
+	return s.scenario.LatencyTarget
+}
+
+func (s *SignalrScenario) LatencyArgument() int {
+	if s.scenario.LatencyArgument == nil {
+		return -1
+	}
+	return *s.scenario.LatencyArgument
+}
+
+func (s *SignalrScenario) JoinGroupTarget() string {
+	return s.scenario.JoinGroupTarget
+}
+
+func (s *SignalrScenario) LeaveGroupTarget() string {
+	return s.scenario.LeaveGroupTarget
+}
+
+func (s *SignalrScenario) IsJson() bool {
+	return s.scenario.Protocol == "json"
+}
+
+func (s *SignalrScenario) IsMsgpack() bool {
+	return s.scenario.Protocol == "messagepack"
+}
+
+func (s *SignalrScenario) FanOut() int {
+	switch s.scenario.FanOut {
+	case "group":
+		return FanOutGroup
+	case "broadcast":
+		return FanOutBroadcast
+	default:
+		return FanOutEcho
+	}
+}
+
+func (s *SignalrScenario) Name() string {
+	if s.scenario != nil && s.scenario.Name != "" {
+		return s.scenario.Name
+	}
+	return "SignalR Scenario"
+}
+
+func (s *SignalrScenario) DoEnsureConnection(count int, conPerSec int) error {
+	return s.doEnsureConnection(count, conPerSec, func(withSessions *WithSessions) (*Session, error) {
+		if s.scenario.Service {
+			return s.SignalrServiceBaseConnect(s.scenario.Protocol)
+		}
+		return s.SignalrCoreBaseConnect(s.scenario.Protocol)
+	})
+}
+
+func (s *SignalrScenario) generator(target string, arguments []string, intervalMillis int) MessageGenerator {
+	return &ScenarioMessageGenerator{
+		WithInterval: WithInterval{
+			interval: time.Millisecond * time.Duration(intervalMillis),
+		},
+		Target:    target,
+		Arguments: arguments,
+		Msgpack:   s.IsMsgpack(),
+	}
+}
+
+func (s *SignalrScenario) DoSend(clients int, intervalMillis int) error {
+	if s.scenario.Target == "" {
+		return nil
+	}
+	return s.doSend(clients, intervalMillis, s.generator(s.scenario.Target, s.scenario.Arguments, intervalMillis))
+}
+
+func (s *SignalrScenario) DoSendRate(clients int, rate int) error {
+	if s.scenario.Target == "" {
+		return nil
+	}
+	return s.doSendRate(clients, rate, s.generator(s.scenario.Target, s.scenario.Arguments, 0))
+}
+
+func (s *SignalrScenario) DoGroupSend(clients int, intervalMillis int) error {
+	if s.scenario.GroupTarget == "" {
+		return nil
+	}
+	return s.doSend(clients, intervalMillis, s.generator(s.scenario.GroupTarget, s.scenario.GroupArguments, intervalMillis))
+}
+
+func (s *SignalrScenario) DoGroupSendRate(clients int, rate int) error {
+	if s.scenario.GroupTarget == "" {
+		return nil
+	}
+	return s.doSendRate(clients, rate, s.generator(s.scenario.GroupTarget, s.scenario.GroupArguments, 0))
+}
+
+// groupMessage invokes the target with the templates, where "{group}" is the group to join or leave.
+func (s *SignalrScenario) groupMessage(target string, templates []string, groupName string) Message {
+	session := &Session{GroupName: groupName}
+	arguments := expandArguments(templates, session, time.Now(), s.IsJson())
+	if s.IsMsgpack() {
+		return GenerateMessagePackRequest(target, arguments)
+	}
+	return GenerateJsonRequest(target, arguments)
+}
+
+func (s *SignalrScenario) DoJoinGroup(membersPerGroup int) error {
+	if s.scenario.JoinGroupTarget == "" {
+		return nil
+	}
+	return s.doJoinGroup(membersPerGroup, func(groupName string) Message {
+		return s.groupMessage(s.scenario.JoinGroupTarget, s.scenario.JoinGroupArguments, groupName)
+	})
+}
+
+func (s *SignalrScenario) DoLeaveGroup() error {
+	if s.scenario.LeaveGroupTarget == "" {
+		return nil
+	}
+	return s.doLeaveGroup(func(groupName string) Message {
+		return s.groupMessage(s.scenario.LeaveGroupTarget, s.scenario.LeaveGroupArguments, groupName)
+	})
+}
@@ -22,6 +22,10 @@ func (s *SignalrServiceJsonBroadcast) IsMsgpack() bool {
 	return false
 }
 
+func (s *SignalrServiceJsonBroadcast) FanOut() int {
+	return FanOutBroadcast
+}
+
 func (s *SignalrServiceJsonBroadcast) Name() string {
 	return "SignalR Service Broadcast"
 }
@@ -34,3 +38,9 @@ func (s *SignalrServiceJsonBroadcast) DoSend(clients int, intervalMillis int) er
 		Target: s.LatencyCheckTarget(),
 	})
 }
+
+func (s *SignalrServiceJsonBroadcast) DoSendRate(clients int, rate int) error {
+	return s.doSendRate(clients, rate, &SignalRCoreTextMessageGenerator{
+		Target: s.LatencyCheckTarget(),
+	})
+}
@@ -40,6 +40,10 @@ func (s *SignalrServiceJsonEcho) DoGroupSend(clients int, intervalMillis int) er
 	return nil
 }
 
+func (s *SignalrServiceJsonEcho) DoGroupSendRate(clients int, rate int) error {
+	return nil
+}
+
 func (s *SignalrServiceJsonEcho) DoSend(clients int, intervalMillis int) error {
 	return s.doSend(clients, intervalMillis, &SignalRCoreTextMessageGenerator{
 		WithInterval: WithInterval{
@@ -48,3 +52,9 @@ func (s *SignalrServiceJsonEcho) DoSend(clients int, intervalMillis int) error {
 		Target: s.LatencyCheckTarget(),
 	})
 }
+
+func (s *SignalrServiceJsonEcho) DoSendRate(clients int, rate int) error {
+	return s.doSendRate(clients, rate, &SignalRCoreTextMessageGenerator{
+		Target: s.LatencyCheckTarget(),
+	})
+}
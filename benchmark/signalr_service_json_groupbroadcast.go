@@ -30,6 +30,10 @@ func (s *SignalrServiceJsonGroupBroadcast) LeaveGroupTarget() string {
 	return "LeaveGroup"
 }
 
+func (s *SignalrServiceJsonGroupBroadcast) FanOut() int {
+	return FanOutGroup
+}
+
 func (s *SignalrServiceJsonGroupBroadcast) Name() string {
 	return "SignalR Service Group Broadcast"
 }
@@ -44,6 +48,10 @@ func (s *SignalrServiceJsonGroupBroadcast) DoSend(clients int, intervalMillis in
 	return nil
 }
 
+func (s *SignalrServiceJsonGroupBroadcast) DoSendRate(clients int, rate int) error {
+	return nil
+}
+
 func (s *SignalrServiceJsonGroupBroadcast) DoGroupSend(clients int, intervalMillis int) error {
 	return s.doSend(clients, intervalMillis, &JsonGroupSendMessageGenerator{
 		WithInterval: WithInterval{
@@ -53,16 +61,22 @@ func (s *SignalrServiceJsonGroupBroadcast) DoGroupSend(clients int, intervalMill
 	})
 }
 
+func (s *SignalrServiceJsonGroupBroadcast) DoGroupSendRate(clients int, rate int) error {
+	return s.doSendRate(clients, rate, &JsonGroupSendMessageGenerator{
+		Target: s.LatencyCheckTarget(),
+	})
+}
+
 func (s *SignalrServiceJsonGroupBroadcast) DoJoinGroup(membersPerGroup int) error {
 	return s.doJoinGroup(membersPerGroup, func(groupName string) Message {
-		arguments := []string{groupName, "perf"}
+		arguments := []interface{}{groupName, "perf"}
 		return GenerateJsonRequest(s.JoinGroupTarget(), arguments)
 	})
 }
 
 func (s *SignalrServiceJsonGroupBroadcast) DoLeaveGroup() error {
 	return s.doLeaveGroup(func(groupName string) Message {
-		arguments := []string{groupName, "perf"}
+		arguments := []interface{}{groupName, "perf"}
 		return GenerateJsonRequest(s.LeaveGroupTarget(), arguments)
 	})
 }
@@ -22,6 +22,10 @@ func (s *SignalrServiceMsgpackBroadcast) IsMsgpack() bool {
 	return true
 }
 
+func (s *SignalrServiceMsgpackBroadcast) FanOut() int {
+	return FanOutBroadcast
+}
+
 func (s *SignalrServiceMsgpackBroadcast) Name() string {
 	return "SignalR Service MsgPack Broadcast"
 }
@@ -34,3 +38,9 @@ func (s *SignalrServiceMsgpackBroadcast) DoSend(clients int, intervalMillis int)
 		Target: s.LatencyCheckTarget(),
 	})
 }
+
+func (s *SignalrServiceMsgpackBroadcast) DoSendRate(clients int, rate int) error {
+	return s.doSendRate(clients, rate, &MessagePackMessageGenerator{
+		Target: s.LatencyCheckTarget(),
+	})
+}
@@ -40,6 +40,10 @@ func (s *SignalrServiceMsgpackEcho) DoGroupSend(clients int, intervalMillis int)
 	return nil
 }
 
+func (s *SignalrServiceMsgpackEcho) DoGroupSendRate(clients int, rate int) error {
+	return nil
+}
+
 func (s *SignalrServiceMsgpackEcho) DoSend(clients int, intervalMillis int) error {
 	return s.doSend(clients, intervalMillis, &MessagePackMessageGenerator{
 		WithInterval: WithInterval{
@@ -48,3 +52,9 @@ func (s *SignalrServiceMsgpackEcho) DoSend(clients int, intervalMillis int) erro
 		Target: s.LatencyCheckTarget(),
 	})
 }
+
+func (s *SignalrServiceMsgpackEcho) DoSendRate(clients int, rate int) error {
+	return s.doSendRate(clients, rate, &MessagePackMessageGenerator{
+		Target: s.LatencyCheckTarget(),
+	})
+}
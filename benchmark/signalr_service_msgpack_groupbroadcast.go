@@ -22,6 +22,10 @@ func (s *SignalrServiceMsgpackGroupBroadcast) IsMsgpack() bool {
 	return true
 }
 
+func (s *SignalrServiceMsgpackGroupBroadcast) FanOut() int {
+	return FanOutGroup
+}
+
 func (s *SignalrServiceMsgpackGroupBroadcast) Name() string {
 	return "SignalR Service MsgPack Echo"
 }
@@ -36,14 +40,14 @@ func (s *SignalrServiceMsgpackGroupBroadcast) LeaveGroupTarget() string {
 
 func (s *SignalrServiceMsgpackGroupBroadcast) DoJoinGroup(membersPerGroup int) error {
 	return s.doJoinGroup(membersPerGroup, func(uid string) Message {
-		arguments := []string{uid, "perf"}
+		arguments := []interface{}{uid, "perf"}
 		return GenerateMessagePackRequest(s.JoinGroupTarget(), arguments)
 	})
 }
 
 func (s *SignalrServiceMsgpackGroupBroadcast) DoLeaveGroup() error {
 	return s.doLeaveGroup(func(groupName string) Message {
-		arguments := []string{groupName, "perf"}
+		arguments := []interface{}{groupName, "perf"}
                 return GenerateMessagePackRequest(s.JoinGroupTarget(), arguments)
 	})
 }
@@ -58,6 +62,10 @@ func (s *SignalrServiceMsgpackGroupBroadcast) DoSend(clients int, intervalMillis
 	return nil
 }
 
+func (s *SignalrServiceMsgpackGroupBroadcast) DoSendRate(clients int, rate int) error {
+	return nil
+}
+
 func (s *SignalrServiceMsgpackGroupBroadcast) DoGroupSend(clients int, intervalMillis int) error {
 	return s.doSend(clients, intervalMillis, &MessagePackGroupSendMessageGenerator{
 		WithInterval: WithInterval{
@@ -66,3 +74,9 @@ func (s *SignalrServiceMsgpackGroupBroadcast) DoGroupSend(clients int, intervalM
 		Target: s.LatencyCheckTarget(),
 	})
 }
+
+func (s *SignalrServiceMsgpackGroupBroadcast) DoGroupSendRate(clients int, rate int) error {
+	return s.doSendRate(clients, rate, &MessagePackGroupSendMessageGenerator{
+		Target: s.LatencyCheckTarget(),
+	})
+}
@@ -0,0 +1,202 @@
+package benchmark
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+
+	"github.com/teris-io/shortid"
+)
+
+// restGroupConcurrency is the number of REST requests adding the users to their groups at a time.
+const restGroupConcurrency = 64
+
+var _ Subject = (*SignalrServiceRest)(nil)
+
+// SignalrServiceRest publishes the messages with the REST API of SignalR Service instead of a hub server, while its
+// JSON connections receive them. It needs the connection string of the service, see ServiceConfig.
+type SignalrServiceRest struct {
+	SignalrCoreCommon
+	rest *restClient
+	// publisher is the running publisher of DoRestSend, nil if not publishing. It is guarded by sessionsLock.
+	publisher *restPublisher
+}
+
+func (s *SignalrServiceRest) Setup(config *Config, p ProtocolProcessing) error {
+	s.sessionsLock.Lock()
+	s.stopPublisherUnsafe()
+	s.sessionsLock.Unlock()
+	if err := s.SignalrCoreCommon.Setup(config, p); err != nil {
+		return err
+	}
+	if config.Service == nil {
+		return fmt.Errorf("The REST API needs the connection string of SignalR Service, start the master with --connection-string")
+	}
+	s.rest = newRestClient(&s.WithCounter, config.Service, s.tlsConfig)
+	return nil
+}
+
+func (s *SignalrServiceRest) LatencyCheckTarget() string {
+	return "restMessage"
+}
+
+func (s *SignalrServiceRest) IsJson() bool {
+	return true
+}
+
+func (s *SignalrServiceRest) IsMsgpack() bool {
+	return false
+}
+
+func (s *SignalrServiceRest) Name() string {
+	return "SignalR Service REST API"
+}
+
+func (s *SignalrServiceRest) DoEnsureConnection(count int, conPerSec int) error {
+	return s.doEnsureConnection(count, conPerSec, func(withSessions *WithSessions) (*Session, error) {
+		return s.SignalrServiceJsonConnect()
+	})
+}
+
+// DoSend does not send from the connections, it stops the publisher so that "s 0" stops publishing as well.
+func (s *SignalrServiceRest) DoSend(clients int, intervalMillis int) error {
+	s.sessionsLock.Lock()
+	defer s.sessionsLock.Unlock()
+	s.stopPublisherUnsafe()
+	return nil
+}
+
+func (s *SignalrServiceRest) DoSendRate(clients int, rate int) error {
+	return nil
+}
+
+func (s *SignalrServiceRest) DoGroupSend(clients int, intervalMillis int) error {
+	return nil
+}
+
+func (s *SignalrServiceRest) DoGroupSendRate(clients int, rate int) error {
+	return nil
+}
+
+// DoRestSend publishes the messages to the audience (broadcast, users or groups) at the rate per second.
+// The users are the connections of this agent, whose connection ID is their user ID, and the groups are
+// the groups joined by DoJoinGroup. The rate 0 stops publishing.
+func (s *SignalrServiceRest) DoRestSend(audience string, rate int) error {
+	s.sessionsLock.Lock()
+	defer s.sessionsLock.Unlock()
+
+	s.stopPublisherUnsafe()
+	if rate <= 0 {
+		return nil
+	}
+
+	var destinations []*restDestination
+	switch audience {
+	case RestBroadcast:
+		destinations = append(destinations, &restDestination{url: s.rest.hubURL("")})
+	case RestUsers:
+		if len(s.rest.service.UserIDClaims) == 0 {
+			return fmt.Errorf("The connections have no user ID, set --service-user-id-claims")
+		}
+		for _, session := range s.sessions {
+			destinations = append(destinations, &restDestination{
+				url:      s.rest.hubURL("/users/" + url.PathEscape(session.ID)),
+				expected: 1,
+			})
+		}
+	case RestGroups:
+		groups := make(map[string]bool)
+		for _, session := range s.sessions {
+			if session.GroupName == "" || groups[session.GroupName] {
+				continue
+			}
+			groups[session.GroupName] = true
+			destinations = append(destinations, &restDestination{
+				url:      s.rest.hubURL("/groups/" + url.PathEscape(session.GroupName)),
+				expected: atomic.LoadInt64(&session.groupSize),
+			})
+		}
+	default:
+		return fmt.Errorf("Unknown REST audience %s, expect %s, %s or %s", audience, RestBroadcast, RestUsers, RestGroups)
+	}
+	if len(destinations) == 0 {
+		return fmt.Errorf("No %s to publish to", audience)
+	}
+
+	sender, err := shortid.Generate()
+	if err != nil {
+		return err
+	}
+	s.publisher = &restPublisher{
+		rest:         s.rest,
+		destinations: destinations,
+		target:       s.LatencyCheckTarget(),
+		sender:       sender,
+		payload:      s.payload,
+		rate:         rate,
+		stop:         make(chan struct{}),
+	}
+	s.publisher.Start()
+	return nil
+}
+
+func (s *SignalrServiceRest) stopPublisherUnsafe() {
+	if s.publisher != nil {
+		s.publisher.Stop()
+		s.publisher = nil
+	}
+}
+
+// DoJoinGroup puts the connections into groups with the REST API, by adding their users to the groups.
+func (s *SignalrServiceRest) DoJoinGroup(membersPerGroup int) error {
+	if len(s.rest.service.UserIDClaims) == 0 {
+		return fmt.Errorf("The connections have no user ID, set --service-user-id-claims")
+	}
+	s.sessionsLock.Lock()
+	defer s.sessionsLock.Unlock()
+
+	s.stopPublisherUnsafe()
+	s.assignGroupsUnsafe(membersPerGroup)
+	s.requestUserGroupsUnsafe(http.MethodPut)
+	return nil
+}
+
+// DoLeaveGroup removes the users of the connections from their groups with the REST API.
+func (s *SignalrServiceRest) DoLeaveGroup() error {
+	s.sessionsLock.Lock()
+	defer s.sessionsLock.Unlock()
+
+	s.stopPublisherUnsafe()
+	s.requestUserGroupsUnsafe(http.MethodDelete)
+	for _, session := range s.sessions {
+		session.GroupName = ""
+		atomic.StoreInt64(&session.groupSize, 0)
+	}
+	return nil
+}
+
+// requestUserGroupsUnsafe adds (PUT) or removes (DELETE) the users of the connections to or from their groups.
+// The requests are counted and timed as rest:group.
+func (s *SignalrServiceRest) requestUserGroupsUnsafe(method string) {
+	var wg sync.WaitGroup
+	limit := make(chan struct{}, restGroupConcurrency)
+	for _, session := range s.sessions {
+		if session.GroupName == "" {
+			continue
+		}
+		requestURL := s.rest.hubURL("/groups/" + url.PathEscape(session.GroupName) + "/users/" + url.PathEscape(session.ID))
+		id := session.ID
+		wg.Add(1)
+		limit <- struct{}{}
+		go func() {
+			defer func() {
+				<-limit
+				wg.Done()
+			}()
+			s.rest.request(id, method, requestURL, nil, "rest:group")
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,18 @@
+package benchmark
+
+var _ Subject = (*SignalrSSEJsonBroadcast)(nil)
+
+// SignalrSSEJsonBroadcast is SignalrCoreJsonBroadcast over the Server-Sent Events transport.
+type SignalrSSEJsonBroadcast struct {
+	SignalrCoreJsonBroadcast
+}
+
+func (s *SignalrSSEJsonBroadcast) Name() string {
+	return "SignalR Server-Sent Events JSON Broadcast"
+}
+
+func (s *SignalrSSEJsonBroadcast) DoEnsureConnection(count int, conPerSec int) error {
+	return s.doEnsureConnection(count, conPerSec, func(withSessions *WithSessions) (*Session, error) {
+		return s.SignalrSSEConnect("json")
+	})
+}
@@ -0,0 +1,18 @@
+package benchmark
+
+var _ Subject = (*SignalrSSEJsonEcho)(nil)
+
+// SignalrSSEJsonEcho is SignalrCoreJsonEcho over the Server-Sent Events transport.
+type SignalrSSEJsonEcho struct {
+	SignalrCoreJsonEcho
+}
+
+func (s *SignalrSSEJsonEcho) Name() string {
+	return "SignalR Server-Sent Events JSON Echo"
+}
+
+func (s *SignalrSSEJsonEcho) DoEnsureConnection(count int, conPerSec int) error {
+	return s.doEnsureConnection(count, conPerSec, func(withSessions *WithSessions) (*Session, error) {
+		return s.SignalrSSEConnect("json")
+	})
+}
@@ -0,0 +1,209 @@
+package benchmark
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+)
+
+// sseDefaultRetry is the delay to reconnect the event stream until the server sets it with a retry field.
+const sseDefaultRetry = 3 * time.Second
+
+// sseTransport receives the frames from a Server-Sent Events stream (GET), where the data of an event is a frame,
+// and sends the frames with POST requests. Like an EventSource, the stream is reconnected when it breaks;
+// the reconnects and the malformed retry fields or frames are counted to sse:reconnect and sse:parse_error.
+// The connection is closed by closing the stream.
+type sseTransport struct {
+	client      *http.Client
+	url         string
+	accessToken string
+	counter     *WithCounter
+	ctx         context.Context
+	cancel      context.CancelFunc
+
+	// the stream is only read by ReadMessage
+	stream *http.Response
+	reader *bufio.Reader
+	parser sseParser
+
+	closeOnce sync.Once
+}
+
+// sseParser parses the lines of an event stream as an EventSource does: the comments, the event types, the
+// unknown fields and the invalid id and retry fields are ignored, and a line without a colon is a field with
+// an empty value.
+type sseParser struct {
+	// data are the data lines of the current event, nil if there is none.
+	data        []string
+	lastEventID string
+	retry       time.Duration
+}
+
+// parseLine parses a line without its line ending. It returns the data of the event if the line dispatches one,
+// and an error if the line is a malformed retry field or the event is not a valid frame.
+func (p *sseParser) parseLine(line string) ([]byte, bool, error) {
+	if line == "" {
+		// an event is dispatched by an empty line
+		data := p.data
+		p.data = nil
+		if data == nil {
+			return nil, false, nil
+		}
+		frame := strings.Join(data, "\n")
+		if !utf8.ValidString(frame) {
+			return nil, false, fmt.Errorf("Invalid frame, the text is not UTF-8")
+		}
+		return []byte(frame), true, nil
+	}
+	if strings.HasPrefix(line, ":") {
+		// comment
+		return nil, false, nil
+	}
+	field, value := line, ""
+	if colon := strings.Index(line, ":"); colon >= 0 {
+		field, value = line[:colon], strings.TrimPrefix(line[colon+1:], " ")
+	}
+	switch field {
+	case "data":
+		p.data = append(p.data, value)
+	case "id":
+		if !strings.ContainsRune(value, 0) {
+			p.lastEventID = value
+		}
+	case "retry":
+		retry, err := strconv.ParseUint(value, 10, 31)
+		if err != nil {
+			return nil, false, fmt.Errorf("Invalid retry: %s", value)
+		}
+		p.retry = time.Duration(retry) * time.Millisecond
+	}
+	// the frames do not have event types, and the other fields are ignored
+	return nil, false, nil
+}
+
+// reset drops the incomplete event when the stream breaks.
+func (p *sseParser) reset() {
+	p.data = nil
+}
+
+var _ Transport = (*sseTransport)(nil)
+
+func newSSETransport(client *http.Client, url string, accessToken string, counter *WithCounter) *sseTransport {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &sseTransport{
+		client:      client,
+		url:         url,
+		accessToken: accessToken,
+		counter:     counter,
+		ctx:         ctx,
+		cancel:      cancel,
+		parser:      sseParser{retry: sseDefaultRetry},
+	}
+}
+
+// connect starts the event stream.
+func (t *sseTransport) connect() error {
+	request, err := newTransportRequest(t.ctx, http.MethodGet, t.url, t.accessToken, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "text/event-stream")
+	request.Header.Set("Cache-Control", "no-cache")
+	if t.parser.lastEventID != "" {
+		request.Header.Set("Last-Event-ID", t.parser.lastEventID)
+	}
+	response, err := t.client.Do(request)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+		return fmt.Errorf("Event stream failed: %s", response.Status)
+	}
+	if contentType := response.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "text/event-stream") {
+		response.Body.Close()
+		return fmt.Errorf("Event stream failed: unexpected content type %s", contentType)
+	}
+	t.stream = response
+	t.reader = bufio.NewReader(response.Body)
+	return nil
+}
+
+// ReadMessage reads the next event with data. The stream is reconnected after the retry delay if it breaks,
+// and an error is returned if it cannot be reconnected.
+func (t *sseTransport) ReadMessage() (int, []byte, error) {
+	for {
+		if t.reader == nil {
+			if err := t.reconnect(); err != nil {
+				return 0, nil, err
+			}
+			t.parser.reset()
+		}
+		line, err := t.reader.ReadString('\n')
+		if err != nil {
+			t.stream.Body.Close()
+			t.reader = nil
+			if t.ctx.Err() != nil {
+				return 0, nil, errTransportClosed
+			}
+			continue
+		}
+
+		frame, ok, err := t.parser.parseLine(strings.TrimRight(line, "\r\n"))
+		if err != nil {
+			// a bad server would flood the log
+			t.counter.Registry().Counter("sse:parse_error").Add(1)
+			continue
+		}
+		if ok {
+			return websocket.TextMessage, frame, nil
+		}
+	}
+}
+
+// reconnect starts the broken stream again after the retry delay.
+func (t *sseTransport) reconnect() error {
+	select {
+	case <-time.After(t.parser.retry):
+	case <-t.ctx.Done():
+		return errTransportClosed
+	}
+	t.counter.Registry().Counter("sse:reconnect").Add(1)
+	if err := t.connect(); err != nil {
+		if t.ctx.Err() != nil {
+			return errTransportClosed
+		}
+		return err
+	}
+	return nil
+}
+
+func (t *sseTransport) WriteMessage(messageType int, data []byte) error {
+	if messageType == websocket.CloseMessage {
+		return t.Close()
+	}
+	return postMessage(t.ctx, t.client, t.url, t.accessToken, data)
+}
+
+// Close closes the event stream, which tells the server to close the connection.
+func (t *sseTransport) Close() error {
+	t.closeOnce.Do(func() {
+		t.cancel()
+		t.client.CloseIdleConnections()
+	})
+	return nil
+}
+
+// SignalrSSEConnect connects to the SignalR core server with the Server-Sent Events transport, which only
+// supports the text protocols, i.e. JSON.
+func (s *SignalrCoreCommon) SignalrSSEConnect(protocol string) (*Session, error) {
+	return s.baseConnect(protocol, s.negotiateDial(protocol, TransportServerSentEvents))
+}
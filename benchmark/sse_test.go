@@ -0,0 +1,67 @@
+package benchmark
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// parseLines parses the lines of an event stream and returns the frames of the events and the number of errors.
+func parseLines(p *sseParser, stream string) ([]string, int) {
+	var frames []string
+	errors := 0
+	for _, line := range strings.Split(stream, "\n") {
+		frame, ok, err := p.parseLine(strings.TrimRight(line, "\r"))
+		if err != nil {
+			errors++
+		}
+		if ok {
+			frames = append(frames, string(frame))
+		}
+	}
+	return frames, errors
+}
+
+func TestSSEParser(t *testing.T) {
+	cases := []struct {
+		name        string
+		stream      string
+		frames      []string
+		errors      int
+		lastEventID string
+		retry       time.Duration
+	}{
+		{"single line", "data: a\n\n", []string{"a"}, 0, "", sseDefaultRetry},
+		{"multi-line data", "data: a\ndata:b\r\ndata:  c\n\ndata: d\n\n", []string{"a\nb\n c", "d"}, 0, "", sseDefaultRetry},
+		{"empty data", "data\n\ndata:\n\n", []string{"", ""}, 0, "", sseDefaultRetry},
+		{"no data", "event: x\n\n\n", nil, 0, "", sseDefaultRetry},
+		{"comments", ":\n: ping\ndata: a\n: between\ndata: b\n\n", []string{"a\nb"}, 0, "", sseDefaultRetry},
+		{"id", "id: 1\ndata: a\n\nid: 2\n\n", []string{"a"}, 0, "2", sseDefaultRetry},
+		{"id with null", "id: 1\n\nid: 2\x00\n\n", nil, 0, "1", sseDefaultRetry},
+		{"retry", "retry: 1500\ndata: a\n\n", []string{"a"}, 0, "", 1500 * time.Millisecond},
+		{"malformed retry", "retry: 100\nretry: 1.5\nretry: -1\nretry\n", nil, 3, "", 100 * time.Millisecond},
+		{"unknown fields", "event: message\nfoo: bar\nfoo\ndata: a\n\n", []string{"a"}, 0, "", sseDefaultRetry},
+		{"invalid frame", "data: \xff\n\ndata: a\n\n", []string{"a"}, 1, "", sseDefaultRetry},
+	}
+	for _, c := range cases {
+		p := &sseParser{retry: sseDefaultRetry}
+		frames, errors := parseLines(p, c.stream)
+		if !reflect.DeepEqual(frames, c.frames) || errors != c.errors {
+			t.Errorf("%s: got %q with %d errors, want %q with %d errors", c.name, frames, errors, c.frames, c.errors)
+		}
+		if p.lastEventID != c.lastEventID || p.retry != c.retry {
+			t.Errorf("%s: got id %q retry %v, want id %q retry %v", c.name, p.lastEventID, p.retry, c.lastEventID, c.retry)
+		}
+	}
+}
+
+func TestSSEParserReset(t *testing.T) {
+	p := &sseParser{retry: sseDefaultRetry}
+	parseLines(p, "id: 1\ndata: lost")
+	p.reset()
+	frames, _ := parseLines(p, "data: a\n\n")
+	if !reflect.DeepEqual(frames, []string{"a"}) || p.lastEventID != "1" {
+		t.Errorf("got %q with id %q, want [\"a\"] with id \"1\"", frames, p.lastEventID)
+	}
+}
@@ -0,0 +1,347 @@
+package benchmark
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack"
+)
+
+// SignalRCoreStreamInvocation starts a stream from the server, whose items arrive as StreamItem
+// messages followed by a Completion, all with the same invocationId.
+type SignalRCoreStreamInvocation struct {
+	Type         int           `json:"type"`
+	InvocationId string        `json:"invocationId"`
+	Target       string        `json:"target"`
+	Arguments    []interface{} `json:"arguments"`
+}
+
+// SignalRCoreStreamItem is an item of a stream. The items received are not used.
+type SignalRCoreStreamItem struct {
+	Type         int         `json:"type"`
+	InvocationId string      `json:"invocationId"`
+	Item         interface{} `json:"item"`
+}
+
+// SignalRCoreCancelInvocation cancels a stream.
+type SignalRCoreCancelInvocation struct {
+	Type         int    `json:"type"`
+	InvocationId string `json:"invocationId"`
+}
+
+// GenerateJsonStreamInvocation generates a StreamInvocation of the target with the arguments.
+func GenerateJsonStreamInvocation(invocationID string, target string, arguments []interface{}) Message {
+	return generateJson(&SignalRCoreStreamInvocation{
+		Type:         4,
+		InvocationId: invocationID,
+		Target:       target,
+		Arguments:    arguments,
+	})
+}
+
+// GenerateJsonCancelInvocation generates a CancelInvocation of the stream.
+func GenerateJsonCancelInvocation(invocationID string) Message {
+	return generateJson(&SignalRCoreCancelInvocation{
+		Type:         5,
+		InvocationId: invocationID,
+	})
+}
+
+func generateJson(v interface{}) Message {
+	msg, err := json.Marshal(v)
+	if err != nil {
+		log.Println("ERROR: failed to encoding SignalR message", err)
+		return nil
+	}
+	msg = append(msg, SignalRMessageTerminator)
+	return PlainMessage{websocket.TextMessage, msg}
+}
+
+// GenerateMessagePackStreamInvocation generates a StreamInvocation of the target with the arguments.
+func GenerateMessagePackStreamInvocation(invocationID string, target string, arguments []interface{}) Message {
+	return generateMessagePack(4, map[string]string{}, invocationID, target, arguments)
+}
+
+// GenerateMessagePackCancelInvocation generates a CancelInvocation of the stream.
+func GenerateMessagePackCancelInvocation(invocationID string) Message {
+	return generateMessagePack(5, map[string]string{}, invocationID)
+}
+
+// generateMessagePack encodes the fields as a MessagePack array prefixed with its length.
+func generateMessagePack(fields ...interface{}) Message {
+	msg, err := msgpack.Marshal(fields)
+	if err != nil {
+		log.Println("ERROR: failed to encoding SignalR message", err)
+		return nil
+	}
+	return PlainMessage{websocket.BinaryMessage, appendLength(msg)}
+}
+
+type streamKey struct {
+	session string
+	id      string
+}
+
+type streamState struct {
+	start time.Time
+	// last is when the last item arrived, zero if there is none.
+	last  time.Time
+	items int64
+	// cancelled is when the stream was cancelled, zero if it is not.
+	cancelled time.Time
+}
+
+// streamTracker tracks the streams started by the sessions of a subject until their completions arrive
+// or they are idle for the timeout.
+type streamTracker struct {
+	lock    sync.Mutex
+	timeout time.Duration
+	streams map[streamKey]*streamState
+	sweeper *wheelTimer
+}
+
+// newStreamTracker starts to track the streams. The streams without any message within timeout are removed
+// and counted to stream:timeout of the counter, unless they are cancelled, and their rates of items are recorded.
+// There is no timeout if it is 0.
+func newStreamTracker(timeout time.Duration, counter *WithCounter) *streamTracker {
+	t := &streamTracker{
+		timeout: timeout,
+		streams: make(map[streamKey]*streamState),
+	}
+	if timeout > 0 {
+		t.sweeper = sessionWheels.Schedule(invocationSweepInterval, invocationSweepInterval, func() {
+			var expired int64
+			for _, state := range t.expire(time.Now()) {
+				// the stream is idle since its last item
+				logStreamRate(counter, state, state.last)
+				if state.cancelled.IsZero() {
+					expired++
+				}
+			}
+			if expired > 0 {
+				counter.Registry().Counter("stream:timeout").Add(expired)
+				counter.Registry().Gauge("stream:active").Add(-expired)
+			}
+		})
+	}
+	return t
+}
+
+// Stop stops checking the timeout.
+func (t *streamTracker) Stop() {
+	if t.sweeper != nil {
+		t.sweeper.Stop()
+	}
+}
+
+func (t *streamTracker) start(session string, id string, now time.Time) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.streams[streamKey{session, id}] = &streamState{start: now}
+}
+
+// item counts an item of the stream and returns the state before it, or false if the stream is unknown.
+func (t *streamTracker) item(session string, id string, now time.Time) (streamState, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	state, ok := t.streams[streamKey{session, id}]
+	if !ok {
+		return streamState{}, false
+	}
+	prev := *state
+	state.items++
+	state.last = now
+	return prev, true
+}
+
+// complete removes the stream and returns its state, or false if it is unknown.
+func (t *streamTracker) complete(session string, id string) (streamState, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	key := streamKey{session, id}
+	state, ok := t.streams[key]
+	if !ok {
+		return streamState{}, false
+	}
+	delete(t.streams, key)
+	return *state, true
+}
+
+// cancel marks up to count random active streams cancelled and returns them.
+func (t *streamTracker) cancel(count int, now time.Time) []streamKey {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	active := make([]streamKey, 0, len(t.streams))
+	for key, state := range t.streams {
+		if state.cancelled.IsZero() {
+			active = append(active, key)
+		}
+	}
+	if count < len(active) {
+		for i := 0; i < count; i++ {
+			j := i + rand.Intn(len(active)-i)
+			active[i], active[j] = active[j], active[i]
+		}
+		active = active[:count]
+	}
+	for _, key := range active {
+		t.streams[key].cancelled = now
+	}
+	return active
+}
+
+// uncancel marks the stream active again, after its CancelInvocation failed to be sent.
+func (t *streamTracker) uncancel(key streamKey) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if state, ok := t.streams[key]; ok {
+		state.cancelled = time.Time{}
+	}
+}
+
+// expire removes the streams idle since now - timeout and returns their states.
+func (t *streamTracker) expire(now time.Time) []streamState {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	deadline := now.Add(-t.timeout)
+	var expired []streamState
+	for key, state := range t.streams {
+		last := state.start
+		if state.last.After(last) {
+			last = state.last
+		}
+		if state.cancelled.After(last) {
+			last = state.cancelled
+		}
+		if last.Before(deadline) {
+			delete(t.streams, key)
+			expired = append(expired, *state)
+		}
+	}
+	return expired
+}
+
+// nextStreamID returns the invocation ID of a new stream of the session, which does not collide
+// with the IDs of the blocking invocations.
+func (s *Session) nextStreamID() string {
+	return "s" + strconv.FormatInt(atomic.AddInt64(&s.streamId, 1), 10)
+}
+
+// doStream starts streams streams on each of clients random sessions, with the invocation made by stream.
+// It does not wait for the sessions whose queues are full, whose streams are counted as stream:start_failed.
+func (s *SignalrCoreCommon) doStream(clients int, streams int, stream func(invocationID string) Message) error {
+	s.sessionsLock.Lock()
+	defer s.sessionsLock.Unlock()
+
+	sessionCount := len(s.sessions)
+	bound := sessionCount
+	if clients < bound {
+		bound = clients
+	}
+
+	indices := rand.Perm(sessionCount)
+	for i := 0; i < bound; i++ {
+		session := s.sessions[indices[i]]
+		for j := 0; j < streams; j++ {
+			id := session.nextStreamID()
+			// the stream is tracked before it is sent, in case its items arrive first
+			s.streams.start(session.ID, id, time.Now())
+			if !session.tryWriteMessage(stream(id)) {
+				s.streams.complete(session.ID, id)
+				s.registry.Counter("stream:start_failed").Add(1)
+				continue
+			}
+			s.registry.Counter("stream:started").Add(1)
+			s.registry.Gauge("stream:active").Add(1)
+		}
+	}
+	return nil
+}
+
+// doCancelStream cancels up to streams random active streams with the CancelInvocation made by cancel.
+// It does not wait for the sessions whose queues are full, whose streams go on and are counted as
+// stream:cancel_failed. The streams of the closed sessions are removed and counted as stream:aborted.
+func (s *SignalrCoreCommon) doCancelStream(streams int, cancel func(invocationID string) Message) error {
+	s.sessionsLock.Lock()
+	defer s.sessionsLock.Unlock()
+
+	sessions := make(map[string]*Session, len(s.sessions))
+	for _, session := range s.sessions {
+		sessions[session.ID] = session
+	}
+	for _, key := range s.streams.cancel(streams, time.Now()) {
+		session, ok := sessions[key.session]
+		switch {
+		case !ok:
+			// the stream is gone with its session
+			s.streams.complete(key.session, key.id)
+			s.registry.Counter("stream:aborted").Add(1)
+		case !session.tryWriteMessage(cancel(key.id)):
+			s.streams.uncancel(key)
+			s.registry.Counter("stream:cancel_failed").Add(1)
+			continue
+		default:
+			s.registry.Counter("stream:cancelled").Add(1)
+		}
+		s.registry.Gauge("stream:active").Add(-1)
+	}
+	return nil
+}
+
+// processStreamItem records the time to the first item of the stream, or else the time since the previous item.
+func (s *SignalrCoreCommon) processStreamItem(clientID string, invocationID string) {
+	now := time.Now()
+	prev, ok := s.streams.item(clientID, invocationID, now)
+	if !ok {
+		s.registry.Counter("stream:unknown_item").Add(1)
+		return
+	}
+	if !prev.cancelled.IsZero() {
+		s.registry.Counter("stream:item_after_cancel").Add(1)
+		return
+	}
+	s.registry.Counter("stream:items").Add(1)
+	if prev.items == 0 {
+		s.LogDuration("stream:first_item", now.Sub(prev.start))
+	} else {
+		s.LogDuration("stream:item_interval", now.Sub(prev.last))
+	}
+}
+
+// processStreamCompletion records the completion of the stream, it returns false if the invocation is not a stream.
+func (s *SignalrCoreCommon) processStreamCompletion(clientID string, invocationID string, errorText string) bool {
+	now := time.Now()
+	state, ok := s.streams.complete(clientID, invocationID)
+	if !ok {
+		return false
+	}
+	if !state.cancelled.IsZero() {
+		// it is counted when cancelled
+		s.LogDuration("stream:cancel", now.Sub(state.cancelled))
+		logStreamRate(&s.WithCounter, state, state.last)
+		return true
+	}
+	s.registry.Gauge("stream:active").Add(-1)
+	s.LogDuration("stream:completion", now.Sub(state.start))
+	logStreamRate(&s.WithCounter, state, now)
+	if errorText != "" {
+		s.LogError("stream:error", clientID, "Stream "+invocationID+" failed", errors.New(errorText))
+	} else {
+		s.registry.Counter("stream:completed").Add(1)
+	}
+	return true
+}
+
+// logStreamRate records the items per second of the stream from its start to the end, if it has any item.
+func logStreamRate(counter *WithCounter, state streamState, end time.Time) {
+	if elapsed := end.Sub(state.start); state.items > 0 && elapsed > 0 {
+		counter.LogRate("stream:items", float64(state.items)/elapsed.Seconds())
+	}
+}
@@ -0,0 +1,126 @@
+package benchmark
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestStreamTracker(timeout time.Duration) *streamTracker {
+	// without the sweeper, expire is called by the tests
+	return &streamTracker{timeout: timeout, streams: make(map[streamKey]*streamState)}
+}
+
+func TestStreamTrackerItem(t *testing.T) {
+	tracker := newTestStreamTracker(0)
+	start := time.Unix(1000, 0)
+	if _, ok := tracker.item("session", "s1", start); ok {
+		t.Errorf("item of an unknown stream is tracked")
+	}
+	tracker.start("session", "s1", start)
+
+	cases := []struct {
+		now   time.Time
+		items int64
+		last  time.Time
+	}{
+		{start.Add(time.Second), 0, time.Time{}},
+		{start.Add(2 * time.Second), 1, start.Add(time.Second)},
+		{start.Add(3 * time.Second), 2, start.Add(2 * time.Second)},
+	}
+	for i, c := range cases {
+		prev, ok := tracker.item("session", "s1", c.now)
+		if !ok || prev.items != c.items || !prev.last.Equal(c.last) || !prev.start.Equal(start) {
+			t.Errorf("item %d: got %+v %v, want %d items last %v", i, prev, ok, c.items, c.last)
+		}
+	}
+	if _, ok := tracker.item("other", "s1", start); ok {
+		t.Errorf("item of the stream of another session is tracked")
+	}
+}
+
+func TestStreamTrackerComplete(t *testing.T) {
+	tracker := newTestStreamTracker(0)
+	start := time.Unix(1000, 0)
+	tracker.start("session", "s1", start)
+	tracker.item("session", "s1", start.Add(time.Second))
+
+	state, ok := tracker.complete("session", "s1")
+	if !ok || state.items != 1 || !state.start.Equal(start) {
+		t.Errorf("complete = %+v %v, want 1 item", state, ok)
+	}
+	if _, ok = tracker.complete("session", "s1"); ok {
+		t.Errorf("a stream is completed twice")
+	}
+	if _, ok = tracker.item("session", "s1", start); ok {
+		t.Errorf("item of a completed stream is tracked")
+	}
+}
+
+func TestStreamTrackerCancel(t *testing.T) {
+	tracker := newTestStreamTracker(0)
+	now := time.Unix(1000, 0)
+	for _, id := range []string{"s1", "s2", "s3"} {
+		tracker.start("session", id, now)
+	}
+
+	cases := []struct {
+		name     string
+		count    int
+		uncancel []string
+		want     int
+	}{
+		{"some", 2, nil, 2},
+		{"the rest", 5, nil, 1},
+		{"none left", 1, nil, 0},
+		{"uncancelled", 5, []string{"s1", "s3"}, 2},
+	}
+	for _, c := range cases {
+		for _, id := range c.uncancel {
+			tracker.uncancel(streamKey{"session", id})
+		}
+		keys := tracker.cancel(c.count, now)
+		if len(keys) != c.want {
+			t.Errorf("%s: cancelled %v, want %d streams", c.name, keys, c.want)
+		}
+		for _, key := range keys {
+			if state := tracker.streams[key]; !state.cancelled.Equal(now) {
+				t.Errorf("%s: %v is cancelled at %v, want %v", c.name, key, state.cancelled, now)
+			}
+		}
+	}
+	// uncancel of an unknown stream is ignored
+	tracker.uncancel(streamKey{"session", "unknown"})
+	if len(tracker.streams) != 3 {
+		t.Errorf("%d streams, want 3", len(tracker.streams))
+	}
+}
+
+func TestStreamTrackerExpire(t *testing.T) {
+	now := time.Unix(1000, 0)
+	timeout := 10 * time.Second
+	cases := []struct {
+		name    string
+		state   streamState
+		expired bool
+	}{
+		{"idle since start", streamState{start: now.Add(-11 * time.Second)}, true},
+		{"recently started", streamState{start: now.Add(-9 * time.Second)}, false},
+		{"recent item", streamState{start: now.Add(-time.Minute), last: now.Add(-time.Second), items: 5}, false},
+		{"idle since item", streamState{start: now.Add(-time.Minute), last: now.Add(-11 * time.Second), items: 5}, true},
+		{"recently cancelled", streamState{start: now.Add(-time.Minute), cancelled: now.Add(-time.Second)}, false},
+		{"cancelled long ago", streamState{start: now.Add(-time.Minute), cancelled: now.Add(-11 * time.Second)}, true},
+	}
+	for _, c := range cases {
+		tracker := newTestStreamTracker(timeout)
+		state := c.state
+		tracker.streams[streamKey{"session", "s1"}] = &state
+		expired := tracker.expire(now)
+		if c.expired != (len(expired) == 1) {
+			t.Errorf("%s: expired %+v, want expired %v", c.name, expired, c.expired)
+			continue
+		}
+		if c.expired && (expired[0] != c.state || len(tracker.streams) != 0) {
+			t.Errorf("%s: expired %+v with %d streams left, want %+v", c.name, expired[0], len(tracker.streams), c.state)
+		}
+	}
+}
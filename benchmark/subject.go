@@ -1,10 +1,14 @@
 package benchmark
 
 import (
-	"fmt"
+	"crypto/tls"
 	"log"
 	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"aspnet.com/util"
@@ -18,6 +22,35 @@ type Config struct {
 	CmdFile  string
 	UseWss   bool
 	SendSize int
+	// TLS is applied to the secure connections, i.e. wss for the SignalR subjects.
+	TLS TLSConfig
+	// Reconnect is the policy to rebuild the connections dropped by the server.
+	Reconnect ReconnectPolicy
+	// SourceIPs are the local IPs the connections are bound to round-robin. It is set by each agent
+	// from its own options, and the system chooses the address if it is empty.
+	SourceIPs []string
+	// LatencyBuckets are the ascending upper bounds of the latency buckets in microseconds.
+	// DefaultLatencyBuckets is used if it is empty.
+	LatencyBuckets []int64
+	// Payload is carried by the messages the subjects send, in addition to the timestamp.
+	Payload PayloadConfig
+	// Scenario defines the hub of the "signalr:scenario" subject, nil if not given.
+	Scenario *Scenario
+	// BlockingInvocation tells the SignalR subjects to send blocking invocations, i.e. with an invocationId,
+	// and to wait for their completions for InvocationTimeout.
+	BlockingInvocation bool
+	InvocationTimeout  time.Duration
+	// KeepAlive makes the SignalR sessions ping the server and detect the server timeout.
+	KeepAlive KeepAlivePolicy
+	// SkipNegotiation makes the SignalR core subjects connect with WebSockets directly, otherwise they negotiate
+	// with NegotiateVersion (0 or 1) first. TransportFallback lets them fall back to Server-Sent Events and
+	// long polling if WebSockets is not available.
+	SkipNegotiation   bool
+	NegotiateVersion  int
+	TransportFallback bool
+	// Service makes the SignalR Service subjects connect to the service directly with the access tokens
+	// minted by the agents, nil to negotiate with the app server at Host.
+	Service *ServiceConfig
 }
 
 // Subject defines the interface for a test subject.
@@ -25,58 +58,162 @@ type Subject interface {
 	ProtocolProcessing
 	Name() string
 	Setup(config *Config, p ProtocolProcessing) error
-	Counters() map[string]int64
+	Counters() *util.MetricsSnapshot
 
 	DoEnsureConnection(count int, conPerSec int) error
 	DoSend(clients int, intervalMillis int) error
 	DoGroupSend(clients int, intervalMillis int) error
+	// DoSendRate and DoGroupSendRate send messages at the aggregate rate per second over the clients
+	// in open loop, see rateScheduler.
+	DoSendRate(clients int, rate int) error
+	DoGroupSendRate(clients int, rate int) error
 	DoJoinGroup(membersPerGroup int) error
 	DoClear(prefix string) error
 }
 
+// Fan-out of the messages sent by a subject, i.e. who is expected to receive them.
+const (
+	// FanOutEcho is received by the sender only.
+	FanOutEcho = iota
+	// FanOutGroup is received by the members of the sender's group.
+	FanOutGroup
+	// FanOutBroadcast is received by all the connections, which are only known by the master, so the messages
+	// are counted as message:broadcast instead of message:expected.
+	FanOutBroadcast
+)
+
+// fanOutSubject is implemented by the subjects whose messages are not echoed to the sender only.
+type fanOutSubject interface {
+	FanOut() int
+}
+
 type WithCounter struct {
-	counter *util.Counter
+	registry       *util.Registry
+	latencyBuckets []int64
 }
 
-func (w *WithCounter) Counter() *util.Counter {
-	return w.counter
+func (w *WithCounter) Registry() *util.Registry {
+	return w.registry
 }
 
 func (w *WithCounter) LogError(errorGroup string, uid string, msg string, err error) {
 	log.Printf("[Error][%s] %s due to %s", uid, msg, err)
 	if errorGroup != "" {
-		w.Counter().Stat(errorGroup, 1)
+		w.Registry().Counter(errorGroup).Add(1)
+	}
+}
+
+// DefaultLatencyBuckets are the latency bucket upper bounds in microseconds: 100ms, 200ms, ..., 1000ms.
+var DefaultLatencyBuckets = []int64{100000, 200000, 300000, 400000, 500000, 600000, 700000, 800000, 900000, 1000000}
+
+// formatLatencyBound formats a bucket bound in microseconds as milliseconds, e.g. 100000 to "100" and 500 to "0.5".
+func formatLatencyBound(bound int64) string {
+	return strconv.FormatFloat(float64(bound)/1000, 'f', -1, 64)
+}
+
+// LatencyBucketNames lists the counter names of the latency buckets for the prefix in the order of buckets.
+func LatencyBucketNames(prefix string, buckets []int64) []string {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
 	}
+	names := make([]string, 0, len(buckets)+1)
+	for _, bound := range buckets {
+		names = append(names, prefix+":lt:"+formatLatencyBound(bound))
+	}
+	return append(names, prefix+":ge:"+formatLatencyBound(buckets[len(buckets)-1]))
 }
 
-const LatencyStep int64 = 100
-const LatencyLength int = 10
+func (w *WithCounter) SetLatencyBuckets(buckets []int64) {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	w.latencyBuckets = buckets
+}
 
+// LogLatency counts the latency (in microseconds) into the latency buckets and records it to the histogram of the prefix.
 func (w *WithCounter) LogLatency(prefix string, latency int64) {
-	index := int(latency / LatencyStep)
-	if index >= LatencyLength {
-		w.Counter().Stat(fmt.Sprintf("%s:ge:%d", prefix, LatencyLength*int(LatencyStep)), 1)
-	} else {
-		w.Counter().Stat(fmt.Sprintf("%s:lt:%d00", prefix, index+1), 1)
+	w.Registry().Histogram(prefix).Record(latency)
+
+	buckets := w.latencyBuckets
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	for _, bound := range buckets {
+		if latency < bound {
+			w.Registry().Counter(prefix + ":lt:" + formatLatencyBound(bound)).Add(1)
+			return
+		}
+	}
+	w.Registry().Counter(prefix + ":ge:" + formatLatencyBound(buckets[len(buckets)-1])).Add(1)
+}
+
+// LogDuration records a duration in microseconds to the histogram of the series, without counting
+// into the latency buckets. It is used for the series where percentiles are enough, e.g. connection phases.
+func (w *WithCounter) LogDuration(name string, d time.Duration) {
+	w.Registry().Histogram(name).Record(int64(d / time.Microsecond))
+}
+
+// Kinds of the histograms, which are told by the suffix of their names.
+const (
+	// HistogramLatency is recorded in microseconds, by LogLatency and LogDuration.
+	HistogramLatency = "latency"
+	// HistogramSize is recorded in bytes by LogSize.
+	HistogramSize = "size"
+	// HistogramRate is recorded in number per second by LogRate.
+	HistogramRate = "rate"
+)
+
+// HistogramKind tells the kind of the histogram from its name.
+func HistogramKind(name string) string {
+	switch {
+	case strings.HasSuffix(name, ":"+HistogramSize):
+		return HistogramSize
+	case strings.HasSuffix(name, ":"+HistogramRate):
+		return HistogramRate
+	default:
+		return HistogramLatency
 	}
 }
 
-func (s *WithCounter) Counters() map[string]int64 {
-	return s.Counter().Snapshot()
+// LogSize records a size in bytes to the histogram "<name>:size".
+func (w *WithCounter) LogSize(name string, size int64) {
+	w.Registry().Histogram(name + ":" + HistogramSize).Record(size)
+}
+
+// LogRate records a rate per second to the histogram "<name>:rate".
+func (w *WithCounter) LogRate(name string, perSecond float64) {
+	w.Registry().Histogram(name + ":" + HistogramRate).Record(int64(perSecond + 0.5))
+}
+
+func (s *WithCounter) Counters() *util.MetricsSnapshot {
+	return s.Registry().Snapshot()
 }
 
 func (s *WithCounter) DoClear(prefix string) error {
-	s.counter.Clear(prefix)
+	s.registry.Clear(prefix)
 	return nil
 }
 
 type WithSessions struct {
-	host         string
-	useWss       bool
-	sendSize     int
-	sessions     []*Session
-	sessionsLock sync.Mutex
-	joinGroupWg  sync.WaitGroup
+	host        string
+	useWss      bool
+	tlsConfig   *tls.Config
+	httpClient  *http.Client
+	sourceAddrs *sourceAddrs
+	sendSize    int
+	payload     *payloadSource
+	// invocations tracks the blocking invocations of the sessions, nil if they are not blocking.
+	invocations *invocationTracker
+	// fanOut is applied to the sessions built by the subject.
+	fanOut int
+	// reconnectPolicy and keepAlive are applied to the sessions built by the subject.
+	reconnectPolicy ReconnectPolicy
+	keepAlive       KeepAlivePolicy
+	sessions        []*Session
+	sessionsLock    sync.Mutex
+	joinGroupWg     sync.WaitGroup
+	// rateScheduler is the running scheduler of doSendRate, nil if not sending by rate.
+	rateScheduler *rateScheduler
 
 	received chan MessageReceived
 }
@@ -151,28 +288,67 @@ func (s *WithSessions) doSend(clients int, intervalMillis int, gen MessageGenera
 	return nil
 }
 
+func (s *WithSessions) doSendRate(clients int, rate int, gen MessageGenerator) error {
+	s.sessionsLock.Lock()
+	defer s.sessionsLock.Unlock()
+
+	s.doStopSendUnsafe()
+
+	sessionCount := len(s.sessions)
+	bound := sessionCount
+	if clients < bound {
+		bound = clients
+	}
+
+	indices := rand.Perm(sessionCount)
+	sessions := make([]*Session, bound)
+	for i := 0; i < bound; i++ {
+		sessions[i] = s.sessions[indices[i]]
+	}
+	s.rateScheduler = newRateScheduler(sessions, gen, rate)
+	s.rateScheduler.Start()
+
+	return nil
+}
+
 func (s *WithSessions) doJoinGroup(membersPerGroup int, joinGroup func(string) Message) error {
 	s.sessionsLock.Lock()
 	defer s.sessionsLock.Unlock()
 
 	s.doStopSendUnsafe()
 
+	s.assignGroupsUnsafe(membersPerGroup)
+	for _, session := range s.sessions {
+		msg := joinGroup(session.GroupName)
+		session.setJoinGroup(msg)
+		session.WriteMessage(msg)
+	}
+	return nil
+}
+
+// assignGroupsUnsafe puts the sessions into random groups of membersPerGroup, and sets their group names and sizes.
+func (s *WithSessions) assignGroupsUnsafe(membersPerGroup int) {
 	sessionCount := len(s.sessions)
 	if membersPerGroup > sessionCount {
 		membersPerGroup = sessionCount
 	}
 	indices := rand.Perm(sessionCount)
-	bound := sessionCount
 	var id string
-	for i := 0; i < bound; i++ {
+	for i := 0; i < sessionCount; i++ {
 		if i%membersPerGroup == 0 {
 			id, _ = shortid.Generate()
 		}
-		msg := joinGroup(id)
 		s.sessions[indices[i]].GroupName = id
-		s.sessions[indices[i]].WriteMessage(msg)
 	}
-	return nil
+
+	// the groups are made of the sessions of this agent only, so their sizes are known here
+	groupSizes := make(map[string]int64)
+	for _, session := range s.sessions {
+		groupSizes[session.GroupName]++
+	}
+	for _, session := range s.sessions {
+		atomic.StoreInt64(&session.groupSize, groupSizes[session.GroupName])
+	}
 }
 
 func (s *WithSessions) doLeaveGroup(leaveGroup func(string) Message) error {
@@ -185,6 +361,8 @@ func (s *WithSessions) doLeaveGroup(leaveGroup func(string) Message) error {
 	indices := rand.Perm(sessionCount)
 	for i := 0; i < sessionCount; i++ {
 		msg := leaveGroup(s.sessions[indices[i]].GroupName)
+		s.sessions[indices[i]].setJoinGroup(nil)
+		atomic.StoreInt64(&s.sessions[indices[i]].groupSize, 0)
 		s.sessions[indices[i]].WriteMessage(msg)
 	}
 	return nil
@@ -198,6 +376,10 @@ func (s *WithSessions) DoStopSend() error {
 }
 
 func (s *WithSessions) doStopSendUnsafe() error {
+	if s.rateScheduler != nil {
+		s.rateScheduler.Stop()
+		s.rateScheduler = nil
+	}
 	for _, session := range s.sessions {
 		session.RemoveMessageGenerator()
 	}
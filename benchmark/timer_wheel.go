@@ -0,0 +1,154 @@
+package benchmark
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// wheelTick is the resolution of the timer wheel.
+	wheelTick = time.Millisecond
+	// wheelSlots is the number of ticks in a round of the wheel, the timers further away wait for more rounds.
+	wheelSlots = 1024
+)
+
+// wheelTimer is a periodic timer on a timerWheel.
+type wheelTimer struct {
+	interval time.Duration
+	fire     func()
+	// rounds is the number of full rounds of the wheel to wait before the timer fires.
+	rounds  int
+	stopped int32
+}
+
+// Stop stops the timer, it is removed from the wheel when its slot is visited next time.
+func (t *wheelTimer) Stop() {
+	atomic.StoreInt32(&t.stopped, 1)
+}
+
+// timerWheel runs periodic timers of many sessions on one goroutine, instead of a goroutine and a time.Ticker
+// per timer. A timer is kept in the slot of the tick it fires at, so the cost of a tick is proportional
+// to the timers due rather than all the timers.
+type timerWheel struct {
+	lock   sync.Mutex
+	slots  [wheelSlots][]*wheelTimer
+	cursor int
+	start  time.Time
+	ticks  int64
+	stop   chan struct{}
+}
+
+func newTimerWheel() *timerWheel {
+	w := &timerWheel{
+		start: time.Now(),
+		stop:  make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Stop stops the wheel, its timers never fire again.
+func (w *timerWheel) Stop() {
+	close(w.stop)
+}
+
+// Schedule fires the timer after delay and then every interval.
+func (w *timerWheel) Schedule(delay time.Duration, interval time.Duration, fire func()) *wheelTimer {
+	t := &wheelTimer{
+		interval: interval,
+		fire:     fire,
+	}
+	w.lock.Lock()
+	w.addUnsafe(t, delay)
+	w.lock.Unlock()
+	return t
+}
+
+func (w *timerWheel) addUnsafe(t *wheelTimer, delay time.Duration) {
+	ticks := int(delay / wheelTick)
+	if ticks < 1 {
+		ticks = 1
+	}
+	t.rounds = (ticks - 1) / wheelSlots
+	slot := (w.cursor + ticks) % wheelSlots
+	w.slots[slot] = append(w.slots[slot], t)
+}
+
+func (w *timerWheel) run() {
+	ticker := time.NewTicker(wheelTick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// catch up with the ticks dropped by the ticker when the timers are slow
+			due := int64(time.Since(w.start) / wheelTick)
+			for w.ticks < due {
+				w.ticks++
+				w.advance()
+			}
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// advance moves the cursor to the next slot and fires the timers due.
+func (w *timerWheel) advance() {
+	w.lock.Lock()
+	w.cursor = (w.cursor + 1) % wheelSlots
+	timers := w.slots[w.cursor]
+	w.slots[w.cursor] = nil
+	w.lock.Unlock()
+
+	var waiting, fired []*wheelTimer
+	for _, t := range timers {
+		if atomic.LoadInt32(&t.stopped) == 1 {
+			continue
+		}
+		if t.rounds > 0 {
+			t.rounds--
+			waiting = append(waiting, t)
+			continue
+		}
+		t.fire()
+		fired = append(fired, t)
+	}
+
+	w.lock.Lock()
+	w.slots[w.cursor] = append(w.slots[w.cursor], waiting...)
+	for _, t := range fired {
+		w.addUnsafe(t, t.interval)
+	}
+	w.lock.Unlock()
+}
+
+// timerWheels are the wheels shared by all the sessions, one for each CPU so that
+// generating the messages is not limited to one core.
+type timerWheels struct {
+	once   sync.Once
+	wheels []*timerWheel
+	next   uint64
+}
+
+var sessionWheels timerWheels
+
+// Schedule adds the timer to the wheels round-robin.
+func (w *timerWheels) Schedule(delay time.Duration, interval time.Duration, fire func()) *wheelTimer {
+	w.once.Do(func() {
+		w.wheels = make([]*timerWheel, runtime.NumCPU())
+		for i := range w.wheels {
+			w.wheels[i] = newTimerWheel()
+		}
+	})
+	n := atomic.AddUint64(&w.next, 1)
+	return w.wheels[n%uint64(len(w.wheels))].Schedule(delay, interval, fire)
+}
+
+// Stop stops the wheels. The shared sessionWheels live as long as the agent and are never stopped.
+func (w *timerWheels) Stop() {
+	for _, wheel := range w.wheels {
+		wheel.Stop()
+	}
+}
@@ -0,0 +1,157 @@
+package benchmark
+
+import (
+	"math/rand"
+	"reflect"
+	"runtime"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+const (
+	benchGenerators = 10000
+	benchInterval   = 100 * time.Millisecond
+)
+
+// startTickerGenerators mirrors the former design of the message generators, where every generator
+// has its own goroutine and time.Ticker, as a baseline for the benchmarks.
+func startTickerGenerators(n int, fire func()) func() {
+	done := make(chan struct{})
+	for i := 0; i < n; i++ {
+		go func() {
+			time.Sleep(time.Millisecond * time.Duration(rand.Int()%1000))
+			ticker := time.NewTicker(benchInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					fire()
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+	return func() {
+		close(done)
+	}
+}
+
+func startWheelGenerators(n int, fire func()) func() {
+	var wheels timerWheels
+	timers := make([]*wheelTimer, n)
+	for i := range timers {
+		delay := time.Millisecond*time.Duration(rand.Int()%1000) + benchInterval
+		timers[i] = wheels.Schedule(delay, benchInterval, fire)
+	}
+	return func() {
+		for _, t := range timers {
+			t.Stop()
+		}
+		wheels.Stop()
+	}
+}
+
+func inuseMemory() uint64 {
+	runtime.GC()
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.HeapInuse + m.StackInuse
+}
+
+// benchmarkGenerators runs the generators until b.N messages are fired in total, and reports the memory
+// taken by each generator and the CPU time of each message.
+func benchmarkGenerators(b *testing.B, start func(n int, fire func()) func()) {
+	var fired int64
+	before := inuseMemory()
+	stop := start(benchGenerators, func() {
+		atomic.AddInt64(&fired, 1)
+	})
+	defer stop()
+	memory := float64(int64(inuseMemory())-int64(before)) / benchGenerators
+
+	// wait for all the generators to start
+	time.Sleep(time.Second + benchInterval)
+	atomic.StoreInt64(&fired, 0)
+	cpuStart := cpuTime()
+	b.ResetTimer()
+	for atomic.LoadInt64(&fired) < int64(b.N) {
+		time.Sleep(time.Millisecond)
+	}
+	b.StopTimer()
+	b.ReportMetric(memory, "B/generator")
+	b.ReportMetric(float64(cpuTime()-cpuStart)/float64(b.N), "cpu-ns/msg")
+}
+
+func BenchmarkTickerGenerators(b *testing.B) {
+	benchmarkGenerators(b, startTickerGenerators)
+}
+
+func BenchmarkTimerWheelGenerators(b *testing.B) {
+	benchmarkGenerators(b, startWheelGenerators)
+}
+
+// cpuTime returns the user and system CPU time of the process in nanoseconds.
+func cpuTime() int64 {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return 0
+	}
+	return usage.Utime.Nano() + usage.Stime.Nano()
+}
+
+// newStoppedTimerWheel creates a wheel which is not running, so that the tests advance it.
+func newStoppedTimerWheel() *timerWheel {
+	return &timerWheel{start: time.Now(), stop: make(chan struct{})}
+}
+
+func TestTimerWheelAdvance(t *testing.T) {
+	w := newStoppedTimerWheel()
+	var fast, slow []int
+	tick := 0
+	fastTimer := w.Schedule(wheelTick, 5*wheelTick, func() {
+		fast = append(fast, tick)
+	})
+	// fires after more than a round of the wheel
+	w.Schedule((wheelSlots+2)*wheelTick, 2*wheelSlots*wheelTick, func() {
+		slow = append(slow, tick)
+	})
+	for tick = 1; tick <= 21; tick++ {
+		w.advance()
+	}
+	if want := []int{1, 6, 11, 16, 21}; !reflect.DeepEqual(fast, want) {
+		t.Errorf("the timer fired at the ticks %v, want %v", fast, want)
+	}
+	fastTimer.Stop()
+	for ; tick <= 3*wheelSlots+2; tick++ {
+		w.advance()
+	}
+	if len(fast) != 5 {
+		t.Errorf("the timer fired %d times after it stopped", len(fast)-5)
+	}
+	if want := []int{wheelSlots + 2, 3*wheelSlots + 2}; !reflect.DeepEqual(slow, want) {
+		t.Errorf("the timer fired at the ticks %v, want %v", slow, want)
+	}
+}
+
+func TestTimerWheelStop(t *testing.T) {
+	w := newStoppedTimerWheel()
+	// the wheel is not due to advance, so it only returns for the stop
+	w.start = time.Now().Add(time.Hour)
+	w.Schedule(wheelTick, wheelTick, func() {
+		t.Error("the timer fired")
+	})
+	w.Stop()
+	done := make(chan struct{})
+	go func() {
+		w.run()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the wheel did not stop")
+	}
+}
@@ -0,0 +1,74 @@
+package benchmark
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+)
+
+// TLSConfig defines the options of the secure connections to the server.
+// The certificates are PEM encoded contents rather than file paths, since they are read by the master
+// and the agents may not have the files.
+type TLSConfig struct {
+	// CACerts is the CA bundle to verify the server certificate. The system roots are used if it is empty.
+	CACerts            []byte
+	InsecureSkipVerify bool
+	// ClientCert and ClientKey are the client certificate and its private key, used if both are set.
+	ClientCert []byte
+	ClientKey  []byte
+	// ServerName overrides the SNI and the name to verify the server certificate with,
+	// which defaults to the host of the URL.
+	ServerName string
+	// MinVersion and MaxVersion are the tls.VersionTLS* constants, 0 means the default of crypto/tls.
+	MinVersion   uint16
+	MaxVersion   uint16
+	CipherSuites []uint16
+}
+
+// Build creates the tls.Config from the options.
+func (c *TLSConfig) Build() (*tls.Config, error) {
+	config := &tls.Config{
+		InsecureSkipVerify: c.InsecureSkipVerify,
+		ServerName:         c.ServerName,
+		MinVersion:         c.MinVersion,
+		MaxVersion:         c.MaxVersion,
+		CipherSuites:       c.CipherSuites,
+	}
+	if len(c.CACerts) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(c.CACerts) {
+			return nil, fmt.Errorf("No valid certificate found in the CA bundle")
+		}
+		config.RootCAs = pool
+	}
+	if len(c.ClientCert) > 0 || len(c.ClientKey) > 0 {
+		cert, err := tls.X509KeyPair(c.ClientCert, c.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// hostname strips the port from the address.
+func hostname(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// clientTLSConfig returns the config to connect to the host, whose name is used for SNI unless it is overridden.
+func clientTLSConfig(config *tls.Config, host string) *tls.Config {
+	if config == nil {
+		config = &tls.Config{}
+	}
+	config = config.Clone()
+	if config.ServerName == "" {
+		config.ServerName = host
+	}
+	return config
+}
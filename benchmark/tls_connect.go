@@ -20,7 +20,20 @@ type TlsConnect struct {
 
 func (s *TlsConnect) Setup(config *Config, p ProtocolProcessing) error {
 	s.host = config.Host
-	s.counter = util.NewCounter()
+	tlsConfig, err := config.TLS.Build()
+	if err != nil {
+		return err
+	}
+	s.tlsConfig = tlsConfig
+	if s.sourceAddrs, err = newSourceAddrs(config.SourceIPs); err != nil {
+		return err
+	}
+	if s.registry != nil {
+		// stop the metrics of the previous run
+		s.registry.Stop()
+	}
+	s.registry = util.NewRegistry()
+	s.SetLatencyBuckets(config.LatencyBuckets)
 	return nil
 }
 
@@ -78,19 +91,24 @@ func (s *TlsConnect) DoEnsureConnection(count int, conPerSec int) error {
 				// randomize the start time of connection
 				time.Sleep(time.Millisecond * time.Duration(rand.Int()%1000))
 
-				s.Counter().Stat("tls:inprogress", 1)
+				s.Registry().Gauge("tls:inprogress").Add(1)
 				t := time.Now()
 
-				_, err := tls.Dial("tcp", s.host, &tls.Config{})
+				conn, err := s.dialTCP(s.host, s.sourceAddrs)
+				if err == nil {
+					if err = tls.Client(conn, clientTLSConfig(s.tlsConfig, hostname(s.host))).Handshake(); err != nil {
+						conn.Close()
+					}
+				}
 				if err != nil {
-					s.Counter().Stat("tls:inprogress", -1)
-					s.Counter().Stat("tls:error", 1)
+					s.Registry().Gauge("tls:inprogress").Add(-1)
+					s.Registry().Counter("tls:error").Add(1)
 					log.Println("Fail to build connection: ", err)
 					return
 				}
-				s.Counter().Stat("tls:inprogress", -1)
-				s.Counter().Stat("tls:connected", 1)
-				s.LogLatency("tls:dial", int64(time.Now().Sub(t)/time.Millisecond))
+				s.Registry().Gauge("tls:inprogress").Add(-1)
+				s.Registry().Counter("tls:connected").Add(1)
+				s.LogLatency("tls:dial", int64(time.Now().Sub(t)/time.Microsecond))
 			}()
 		}
 		count -= nextBatch
@@ -107,6 +125,14 @@ func (s *TlsConnect) DoGroupSend(clients int, intervalMillis int) error {
 	return nil
 }
 
+func (s *TlsConnect) DoGroupSendRate(clients int, rate int) error {
+	return nil
+}
+
 func (s *TlsConnect) DoSend(clients int, intervalMillis int) error {
 	return nil
 }
+
+func (s *TlsConnect) DoSendRate(clients int, rate int) error {
+	return nil
+}
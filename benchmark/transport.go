@@ -0,0 +1,77 @@
+package benchmark
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+)
+
+// Transport delivers the frames of a session. *websocket.Conn is the WebSocket transport, and the HTTP
+// transports of SignalR implement the same methods, so that the sessions and the protocol processing
+// do not care which transport a frame came from.
+type Transport interface {
+	// ReadMessage blocks until the next frame arrives. It returns a *websocket.CloseError when the
+	// connection is closed normally.
+	ReadMessage() (messageType int, data []byte, err error)
+	WriteMessage(messageType int, data []byte) error
+	Close() error
+}
+
+var _ Transport = (*websocket.Conn)(nil)
+
+// errTransportClosed is returned by the HTTP transports once they are closed by us or by the server.
+var errTransportClosed = &websocket.CloseError{Code: websocket.CloseNormalClosure, Text: "transport closed"}
+
+// httpURL returns the HTTP URL of the path on the server.
+func (s *SignalrCoreCommon) httpURL(path string) string {
+	if s.useWss {
+		return "https://" + s.host + path
+	}
+	return "http://" + s.host + path
+}
+
+// newTransportRequest makes a request of the HTTP transports, authorized with the access token if it is not empty.
+func newTransportRequest(ctx context.Context, method string, url string, accessToken string, body io.Reader) (*http.Request, error) {
+	request, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if accessToken != "" {
+		request.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	return request, nil
+}
+
+// postMessage sends a frame of the HTTP transports with a POST request.
+func postMessage(ctx context.Context, client *http.Client, url string, accessToken string, data []byte) error {
+	request, err := newTransportRequest(ctx, http.MethodPost, url, accessToken, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("Send failed: %s", response.Status)
+	}
+	return nil
+}
+
+// newSessionHTTPClient creates the HTTP client of the transport of a session, whose connections are made
+// from the source addresses and are not shared with the other sessions.
+func (s *SignalrCoreCommon) newSessionHTTPClient() *http.Client {
+	client := newHTTPClient(s.tlsConfig)
+	client.Transport.(*http.Transport).DialContext = func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		return s.dialTCP(addr, s.sourceAddrs)
+	}
+	return client
+}
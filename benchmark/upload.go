@@ -0,0 +1,268 @@
+package benchmark
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"aspnet.com/util"
+)
+
+// uploadProtocol makes the messages of an upload stream in the protocol of a subject.
+type uploadProtocol struct {
+	invocation func(invocationID string, target string, streamID string) Message
+	item       func(streamID string, item string) Message
+	completion func(streamID string) Message
+}
+
+var jsonUploadProtocol = uploadProtocol{
+	invocation: func(invocationID string, target string, streamID string) Message {
+		return GenerateJsonUploadInvocation(invocationID, target, []interface{}{}, []string{streamID})
+	},
+	item:       GenerateJsonStreamItem,
+	completion: GenerateJsonStreamCompletion,
+}
+
+var msgpackUploadProtocol = uploadProtocol{
+	invocation: func(invocationID string, target string, streamID string) Message {
+		return GenerateMessagePackUploadInvocation(invocationID, target, []interface{}{}, []string{streamID})
+	},
+	item:       GenerateMessagePackStreamItem,
+	completion: GenerateMessagePackStreamCompletion,
+}
+
+type uploadState struct {
+	start time.Time
+	// last is when the last message of the upload was queued.
+	last  time.Time
+	bytes int64
+	// completed is when the Completion of the stream was queued, zero if the items are still being sent.
+	completed time.Time
+}
+
+// uploadTracker tracks the uploads of the sessions of a subject, by the invocationId of the hub method taking
+// the stream, until the server acknowledges them with the completion of the invocation.
+type uploadTracker struct {
+	lock    sync.Mutex
+	timeout time.Duration
+	uploads map[streamKey]*uploadState
+	sweeper *wheelTimer
+}
+
+// newUploadTracker starts to track the uploads. The uploads without any progress within timeout, i.e. neither
+// sent by us nor acknowledged by the server, are removed and counted to upload:timeout of the registry.
+// There is no timeout if it is 0.
+func newUploadTracker(timeout time.Duration, registry *util.Registry) *uploadTracker {
+	t := &uploadTracker{
+		timeout: timeout,
+		uploads: make(map[streamKey]*uploadState),
+	}
+	if timeout > 0 {
+		t.sweeper = sessionWheels.Schedule(invocationSweepInterval, invocationSweepInterval, func() {
+			if expired := t.expire(time.Now()); expired > 0 {
+				registry.Counter("upload:timeout").Add(expired)
+				registry.Gauge("upload:active").Add(-expired)
+			}
+		})
+	}
+	return t
+}
+
+// Stop stops checking the timeout.
+func (t *uploadTracker) Stop() {
+	if t.sweeper != nil {
+		t.sweeper.Stop()
+	}
+}
+
+func (t *uploadTracker) start(session string, id string, now time.Time) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.uploads[streamKey{session, id}] = &uploadState{start: now, last: now}
+}
+
+// sent records an item of size bytes, or the completion of the stream if completed, queued at now.
+// It returns false if the upload is removed already.
+func (t *uploadTracker) sent(session string, id string, size int, completed bool, now time.Time) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	state, ok := t.uploads[streamKey{session, id}]
+	if !ok {
+		return false
+	}
+	state.last = now
+	state.bytes += int64(size)
+	if completed {
+		state.completed = now
+	}
+	return true
+}
+
+// remove removes the upload and returns its state, or false if it is unknown or timed out already.
+func (t *uploadTracker) remove(session string, id string) (uploadState, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	key := streamKey{session, id}
+	state, ok := t.uploads[key]
+	if !ok {
+		return uploadState{}, false
+	}
+	delete(t.uploads, key)
+	return *state, true
+}
+
+// expire removes the uploads idle since now - timeout and returns the number of them.
+func (t *uploadTracker) expire(now time.Time) int64 {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	deadline := now.Add(-t.timeout)
+	var expired int64
+	for key, state := range t.uploads {
+		if state.last.Before(deadline) {
+			delete(t.uploads, key)
+			expired++
+		}
+	}
+	return expired
+}
+
+// upload sends the items of an upload stream of a session at a rate, from the shared timer wheel.
+type upload struct {
+	lock     sync.Mutex
+	common   *SignalrCoreCommon
+	session  *Session
+	protocol uploadProtocol
+	id       string
+	streamID string
+	items    int
+	rate     int
+	size     int
+	sent     int
+	start    time.Time
+	timer    *wheelTimer
+}
+
+// doUpload invokes the target with an upload stream on each of clients random sessions, and sends items items
+// of size bytes at rate items per second to each stream, followed by the completion of the stream. It does not
+// wait for the sessions whose queues are full, whose uploads are counted as upload:start_failed.
+func (s *SignalrCoreCommon) doUpload(clients int, items int, rate int, size int, target string, protocol uploadProtocol) error {
+	if rate <= 0 {
+		return errors.New("The rate of the upload items must be positive")
+	}
+	s.sessionsLock.Lock()
+	defer s.sessionsLock.Unlock()
+
+	sessionCount := len(s.sessions)
+	bound := sessionCount
+	if clients < bound {
+		bound = clients
+	}
+
+	interval := time.Second / time.Duration(rate)
+	if interval < wheelTick {
+		// more than an item is sent on a tick
+		interval = wheelTick
+	}
+	indices := rand.Perm(sessionCount)
+	for i := 0; i < bound; i++ {
+		u := &upload{
+			common:   s,
+			session:  s.sessions[indices[i]],
+			protocol: protocol,
+			id:       s.sessions[indices[i]].nextStreamID(),
+			streamID: s.sessions[indices[i]].nextStreamID(),
+			items:    items,
+			rate:     rate,
+			size:     size,
+		}
+		u.start = time.Now()
+		// the upload is tracked before it is sent, in case its completion arrives first
+		s.uploads.start(u.session.ID, u.id, u.start)
+		if !u.session.tryWriteMessage(protocol.invocation(u.id, target, u.streamID)) {
+			s.uploads.remove(u.session.ID, u.id)
+			s.registry.Counter("upload:start_failed").Add(1)
+			continue
+		}
+		s.registry.Counter("upload:started").Add(1)
+		s.registry.Gauge("upload:active").Add(1)
+
+		u.lock.Lock()
+		u.timer = sessionWheels.Schedule(interval, interval, u.tick)
+		u.lock.Unlock()
+	}
+	return nil
+}
+
+// tick queues the items due by now without blocking, the ones which do not fit in the queue are sent on the
+// next tick. The completion of the stream is queued after the last item.
+func (u *upload) tick() {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	if u.timer == nil {
+		return
+	}
+	session := u.session
+	registry := u.common.registry
+	if atomic.LoadInt32(&session.closing) == 1 || atomic.LoadInt32(&session.dropped) == 1 {
+		// the invocation taking the stream is gone with the connection, even if it is reconnected
+		u.stop()
+		if _, ok := u.common.uploads.remove(session.ID, u.id); ok {
+			registry.Counter("upload:aborted").Add(1)
+			registry.Gauge("upload:active").Add(-1)
+		}
+		return
+	}
+
+	due := int(time.Since(u.start).Seconds()*float64(u.rate)) + 1
+	if due > u.items {
+		due = u.items
+	}
+	for u.sent < due {
+		item := RandStringBytesMaskImprSrc(u.size)
+		if !session.tryWriteMessage(u.protocol.item(u.streamID, item)) {
+			return
+		}
+		u.sent++
+		registry.Counter("upload:items").Add(1)
+		if !u.common.uploads.sent(session.ID, u.id, len(item), false, time.Now()) {
+			// timed out
+			u.stop()
+			return
+		}
+	}
+	if u.sent == u.items && session.tryWriteMessage(u.protocol.completion(u.streamID)) {
+		u.common.uploads.sent(session.ID, u.id, 0, true, time.Now())
+		u.stop()
+	}
+}
+
+func (u *upload) stop() {
+	u.timer.Stop()
+	u.timer = nil
+}
+
+// processUploadCompletion records the latency from the completion of an upload stream to its acknowledgement,
+// i.e. the completion of the invocation taking the stream, and the throughput of the upload. It returns false
+// if the invocation is not an upload.
+func (s *SignalrCoreCommon) processUploadCompletion(clientID string, invocationID string, errorText string) bool {
+	now := time.Now()
+	state, ok := s.uploads.remove(clientID, invocationID)
+	if !ok {
+		return false
+	}
+	s.registry.Gauge("upload:active").Add(-1)
+	if !state.completed.IsZero() {
+		s.LogDuration("upload:ack", now.Sub(state.completed))
+	}
+	if elapsed := now.Sub(state.start); elapsed > 0 {
+		s.LogRate("upload:bytes", float64(state.bytes)/elapsed.Seconds())
+	}
+	if errorText != "" {
+		s.LogError("upload:error", clientID, "Upload "+invocationID+" failed", errors.New(errorText))
+	} else {
+		s.registry.Counter("upload:completed").Add(1)
+	}
+	return true
+}
@@ -2,11 +2,15 @@ package main
 
 import (
 	"bufio"
+	"crypto/tls"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"math"
 	"net"
 	"net/rpc"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -31,7 +35,41 @@ var opts struct {
 	CmdFile          string `short:"c" long:"cmd-file" description:"Command file"`
 	UseWss           bool   `short:"u" long:"use-security-connection" description:"wss connection"`
 	SendSize         int    `short:"b" long:"send-size" description:"send message size (byte), default is 0, 0 means: a shortID + timestamp" default:"0"`
+	Scenario         string `long:"scenario" description:"JSON or YAML file defining the hub of the signalr:scenario subject"`
+	Payload          string `long:"payload" description:"Payload of the messages: fixed:<size>, uniform:<min>-<max>, normal:<mean>,<stddev>, buckets:<file> or corpus:<file>"`
 	ReverseAgent     bool   `short:"r" long:"reverse" description:"Reverse agent mode"`
+	SourceIPs        string `long:"source-ips" description:"Local IPs separated by comma to bind the connections of the agent to round-robin"`
+	LatencyBuckets   string `long:"latency-buckets" description:"Latency bucket upper bounds (ms) separated by comma, e.g. 0.5,1,5,10,100" default:"100,200,300,400,500,600,700,800,900,1000"`
+
+	BlockingInvocation bool `long:"blocking-invocation" description:"Send blocking SignalR invocations with an invocationId and measure their completions"`
+	InvocationTimeout  int  `long:"invocation-timeout" description:"Timeout (ms) of the blocking invocations" default:"30000"`
+
+	KeepAliveInterval int `long:"keep-alive-interval" description:"Interval (ms) of the SignalR pings sent when idle, 0 means no ping" default:"0"`
+	ServerTimeout     int `long:"server-timeout" description:"Timeout (ms) to close a SignalR connection receiving nothing from the server, 0 means no timeout" default:"0"`
+
+	SkipNegotiation   bool `long:"skip-negotiation" description:"Connect the SignalR core subjects with WebSockets directly without negotiate"`
+	NegotiateVersion  int  `long:"negotiate-version" description:"Negotiate version of the SignalR core subjects" default:"1" choice:"0" choice:"1"`
+	TransportFallback bool `long:"transport-fallback" description:"Fall back to Server-Sent Events and long polling if WebSockets is not available"`
+
+	ConnectionString     string `long:"connection-string" description:"SignalR Service connection string (Endpoint=...;AccessKey=...) to connect the service subjects directly with local access tokens"`
+	ServiceHub           string `long:"service-hub" description:"Hub of the SignalR Service connections, required with --connection-string"`
+	ServiceAudience      string `long:"service-audience" description:"Audience of the SignalR Service client tokens, default is the client URL of the hub"`
+	ServiceUserIDClaims  string `long:"service-user-id-claims" description:"Claims of the user ID (the connection ID) in the SignalR Service client tokens separated by comma, empty means no user ID" default:"asrs.s.uid"`
+	ServiceTokenLifetime int    `long:"service-token-lifetime" description:"Lifetime (s) of the SignalR Service access tokens" default:"3600"`
+
+	Reconnect             string `long:"reconnect" description:"Reconnect policy of the dropped connections" default:"none" choice:"none" choice:"immediate" choice:"backoff"`
+	ReconnectMaxAttempts  int    `long:"reconnect-max-attempts" description:"Max reconnect attempts of a dropped connection, 0 means no limit" default:"0"`
+	ReconnectInitialDelay int    `long:"reconnect-initial-delay" description:"Initial backoff (ms) of the reconnection, doubled on each attempt" default:"1000"`
+	ReconnectMaxDelay     int    `long:"reconnect-max-delay" description:"Max backoff (ms) of the reconnection" default:"30000"`
+
+	TLSCAFile             string `long:"tls-ca-file" description:"PEM CA bundle to verify the server certificate, default is the system roots"`
+	TLSInsecureSkipVerify bool   `long:"tls-insecure-skip-verify" description:"Do not verify the server certificate"`
+	TLSCertFile           string `long:"tls-cert-file" description:"PEM client certificate"`
+	TLSKeyFile            string `long:"tls-key-file" description:"PEM private key of the client certificate"`
+	TLSServerName         string `long:"tls-server-name" description:"Override the SNI and the server name to verify"`
+	TLSMinVersion         string `long:"tls-min-version" description:"Minimum TLS version" choice:"1.0" choice:"1.1" choice:"1.2" choice:"1.3"`
+	TLSMaxVersion         string `long:"tls-max-version" description:"Maximum TLS version" choice:"1.0" choice:"1.1" choice:"1.2" choice:"1.3"`
+	TLSCipherSuites       string `long:"tls-cipher-suites" description:"TLS cipher suite names separated by comma, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"`
 
 	InfluxDBAddr string `long:"influxdb-addr" description:"Output InfluxDB address"`
 	InfluxDBName string `long:"influxdb-name" description:"Output InfluxDB database name"`
@@ -85,8 +123,144 @@ func parseAgentConfigs(data string) []agentConfig {
 	return cfgs
 }
 
+// parseLatencyBuckets converts the millisecond bucket bounds to ascending microsecond bounds.
+func parseLatencyBuckets(data string) []int64 {
+	parts := strings.Split(data, ",")
+	buckets := make([]int64, 0, len(parts))
+	for _, part := range parts {
+		ms, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			log.Fatalf("Invalid latency bucket: %s", part)
+		}
+		bound := int64(math.Round(ms * 1000))
+		if len(buckets) > 0 && bound <= buckets[len(buckets)-1] {
+			log.Fatalf("Latency buckets must be ascending: %s", data)
+		}
+		buckets = append(buckets, bound)
+	}
+	return buckets
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+func readPEMFile(path string) []byte {
+	if path == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Fatalln("Failed to read", path, err)
+	}
+	return data
+}
+
+// parseCipherSuites converts the cipher suite names to their IDs.
+func parseCipherSuites(data string) []uint16 {
+	if data == "" {
+		return nil
+	}
+	ids := make(map[string]uint16)
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		ids[suite.Name] = suite.ID
+	}
+	parts := strings.Split(data, ",")
+	suites := make([]uint16, 0, len(parts))
+	for _, part := range parts {
+		id, ok := ids[strings.TrimSpace(part)]
+		if !ok {
+			log.Fatalf("Unknown TLS cipher suite: %s", part)
+		}
+		suites = append(suites, id)
+	}
+	return suites
+}
+
+// parseTLSConfig reads the TLS options, the certificate files are read here and sent to the agents.
+func parseTLSConfig() benchmark.TLSConfig {
+	config := benchmark.TLSConfig{
+		CACerts:            readPEMFile(opts.TLSCAFile),
+		InsecureSkipVerify: opts.TLSInsecureSkipVerify,
+		ClientCert:         readPEMFile(opts.TLSCertFile),
+		ClientKey:          readPEMFile(opts.TLSKeyFile),
+		ServerName:         opts.TLSServerName,
+		MinVersion:         tlsVersions[opts.TLSMinVersion],
+		MaxVersion:         tlsVersions[opts.TLSMaxVersion],
+		CipherSuites:       parseCipherSuites(opts.TLSCipherSuites),
+	}
+	// fail fast instead of on every agent
+	if _, err := config.Build(); err != nil {
+		log.Fatalln("Invalid TLS options:", err)
+	}
+	return config
+}
+
+func parseReconnectPolicy() benchmark.ReconnectPolicy {
+	return benchmark.ReconnectPolicy{
+		Mode:         opts.Reconnect,
+		MaxAttempts:  opts.ReconnectMaxAttempts,
+		InitialDelay: time.Duration(opts.ReconnectInitialDelay) * time.Millisecond,
+		MaxDelay:     time.Duration(opts.ReconnectMaxDelay) * time.Millisecond,
+	}
+}
+
+func parsePayloadConfig() benchmark.PayloadConfig {
+	config, err := benchmark.ParsePayloadConfig(opts.Payload)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	return config
+}
+
+// parseServiceConfig parses the connection string of SignalR Service, nil if it is not given.
+func parseServiceConfig() *benchmark.ServiceConfig {
+	if opts.ConnectionString == "" {
+		return nil
+	}
+	config, err := benchmark.ParseConnectionString(opts.ConnectionString)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if opts.ServiceHub == "" {
+		log.Fatalln("Hub was not specified for the connection string")
+	}
+	if opts.ServiceTokenLifetime <= 0 {
+		log.Fatalln("Invalid token lifetime:", opts.ServiceTokenLifetime)
+	}
+	config.Hub = opts.ServiceHub
+	config.Audience = opts.ServiceAudience
+	config.UserIDClaims = parseUserIDClaims(opts.ServiceUserIDClaims)
+	config.TokenLifetime = time.Duration(opts.ServiceTokenLifetime) * time.Second
+	return config
+}
+
+func parseUserIDClaims(data string) []string {
+	var claims []string
+	for _, claim := range strings.Split(data, ",") {
+		if claim = strings.TrimSpace(claim); claim != "" {
+			claims = append(claims, claim)
+		}
+	}
+	return claims
+}
+
+func loadScenario() *benchmark.Scenario {
+	if opts.Scenario == "" {
+		return nil
+	}
+	scenario, err := benchmark.LoadScenario(opts.Scenario)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	return scenario
+}
+
 func startMaster() {
-	if opts.Server == "" {
+	if opts.Server == "" && opts.ConnectionString == "" {
 		log.Fatalln("Server host:port was not specified")
 	}
 
@@ -135,11 +309,27 @@ func startMaster() {
 	}
 
 	c.Run(&benchmark.Config{
-		Host:     opts.Server,
-		Subject:  opts.Subject,
-		CmdFile:  opts.CmdFile,
-		UseWss:   opts.UseWss,
-		SendSize: opts.SendSize,
+		Host:           opts.Server,
+		Subject:        opts.Subject,
+		CmdFile:        opts.CmdFile,
+		UseWss:         opts.UseWss,
+		SendSize:       opts.SendSize,
+		TLS:            parseTLSConfig(),
+		Reconnect:      parseReconnectPolicy(),
+		LatencyBuckets: parseLatencyBuckets(opts.LatencyBuckets),
+		Payload:        parsePayloadConfig(),
+		Scenario:       loadScenario(),
+
+		BlockingInvocation: opts.BlockingInvocation,
+		InvocationTimeout:  time.Duration(opts.InvocationTimeout) * time.Millisecond,
+		KeepAlive: benchmark.KeepAlivePolicy{
+			Interval:      time.Duration(opts.KeepAliveInterval) * time.Millisecond,
+			ServerTimeout: time.Duration(opts.ServerTimeout) * time.Millisecond,
+		},
+		SkipNegotiation:   opts.SkipNegotiation,
+		NegotiateVersion:  opts.NegotiateVersion,
+		TransportFallback: opts.TransportFallback,
+		Service:           parseServiceConfig(),
 	})
 }
 
@@ -157,10 +347,25 @@ func genPidFile(pidfile string) {
 	}
 }
 
+func parseSourceIPs(data string) []string {
+	if data == "" {
+		return nil
+	}
+	ips := strings.Split(data, ",")
+	for i, ip := range ips {
+		ips[i] = strings.TrimSpace(ip)
+		if net.ParseIP(ips[i]) == nil {
+			log.Fatalf("Invalid source IP: %s", ip)
+		}
+	}
+	return ips
+}
+
 func startAgent() {
 	genPidFile("/tmp/websocket-bench.pid")
 	rpc.RegisterName("Agent", &agent.Controller{
 		AgentRole: opts.Role,
+		SourceIPs: parseSourceIPs(opts.SourceIPs),
 	})
 	if !opts.ReverseAgent {
 		l, err := net.Listen("tcp", opts.ListenAddress)
@@ -0,0 +1,144 @@
+package master
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"aspnet.com/agent"
+)
+
+const (
+	// clockSyncInterval is how often the clocks of the agents are estimated again during the run.
+	clockSyncInterval = 10 * time.Second
+	// clockSyncRounds is the number of pings sent to an agent in each synchronization.
+	clockSyncRounds = 5
+	// clockSamples is the number of recent samples the estimate is chosen from.
+	clockSamples = 16
+)
+
+type clockSample struct {
+	Offset time.Duration
+	RTT    time.Duration
+}
+
+// clockEstimate is the clock of an agent relative to the master.
+type clockEstimate struct {
+	// Offset is the agent clock minus the master clock.
+	Offset time.Duration
+	RTT    time.Duration
+	// ErrorBound is the maximum error of Offset, which is half of the round trip time of the chosen sample.
+	ErrorBound time.Duration
+	Samples    int
+}
+
+// clockFilter keeps the recent ping samples of an agent and estimates its clock from the sample
+// with the lowest round trip time, which is the least affected by queueing delays, as NTP does.
+type clockFilter struct {
+	lock     sync.Mutex
+	samples  []clockSample
+	estimate clockEstimate
+}
+
+func (f *clockFilter) add(sample clockSample) clockEstimate {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.samples = append(f.samples, sample)
+	if len(f.samples) > clockSamples {
+		f.samples = f.samples[len(f.samples)-clockSamples:]
+	}
+	best := f.samples[0]
+	for _, s := range f.samples[1:] {
+		if s.RTT < best.RTT {
+			best = s
+		}
+	}
+	f.estimate = clockEstimate{
+		Offset:     best.Offset,
+		RTT:        best.RTT,
+		ErrorBound: best.RTT / 2,
+		Samples:    f.estimate.Samples + 1,
+	}
+	return f.estimate
+}
+
+func (f *clockFilter) get() clockEstimate {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.estimate
+}
+
+// newClockSample computes the sample of a NTP style exchange:
+// offset = ((t1 - t0) + (t2 - t3)) / 2 and rtt = (t3 - t0) - (t2 - t1),
+// where t0, t3 are the master clock and t1, t2 are the agent clock.
+func newClockSample(t0, t1, t2, t3 time.Time) clockSample {
+	return clockSample{
+		Offset: (t1.Sub(t0) + t2.Sub(t3)) / 2,
+		RTT:    t3.Sub(t0) - t2.Sub(t1),
+	}
+}
+
+// pingAgent does a NTP style exchange with the agent.
+func pingAgent(agentProxy *AgentProxy) (clockSample, error) {
+	var reply agent.PingReply
+	t0 := time.Now()
+	err := agentProxy.Client.Call("Agent.Ping", &agent.PingArgs{
+		MasterSendTime: t0.UnixNano(),
+	}, &reply)
+	t3 := time.Now()
+	if err != nil {
+		return clockSample{}, err
+	}
+	return newClockSample(t0, time.Unix(0, reply.AgentReceiveTime), time.Unix(0, reply.AgentSendTime), t3), nil
+}
+
+// syncClocks estimates the clock offset of every agent and makes the agents correct their timestamps with it.
+func (c *Controller) syncClocks(verbose bool) {
+	var wg sync.WaitGroup
+	for _, agentProxy := range c.Agents {
+		wg.Add(1)
+		go func(agentProxy *AgentProxy) {
+			defer wg.Done()
+			var estimate clockEstimate
+			for i := 0; i < clockSyncRounds; i++ {
+				sample, err := pingAgent(agentProxy)
+				if err != nil {
+					log.Println("ERROR: Failed to ping agent: ", agentProxy.Address, err)
+					return
+				}
+				estimate = agentProxy.clock.add(sample)
+			}
+			err := agentProxy.Client.Call("Agent.SetClockOffset", &agent.SetClockOffsetArgs{
+				Offset:     estimate.Offset,
+				ErrorBound: estimate.ErrorBound,
+			}, nil)
+			if err != nil {
+				log.Println("ERROR: Failed to set clock offset of agent: ", agentProxy.Address, err)
+				return
+			}
+			if verbose {
+				log.Printf("Clock of %s: offset %v (+/- %v), rtt %v\n", agentProxy.Address, estimate.Offset, estimate.ErrorBound, estimate.RTT)
+			}
+		}(agentProxy)
+	}
+	wg.Wait()
+}
+
+// watchClocks keeps tracking the clock offsets of the agents, which may drift during a long run.
+func (c *Controller) watchClocks() {
+	stopChan := make(chan struct{})
+	registerStopChannels(stopChan)
+	go func() {
+		ticker := time.NewTicker(clockSyncInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.syncClocks(false)
+			case <-stopChan:
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,115 @@
+package master
+
+import (
+	"net"
+	"net/rpc"
+	"testing"
+	"time"
+
+	"aspnet.com/agent"
+)
+
+func TestNewClockSample(t *testing.T) {
+	t0 := time.Unix(1000, 0)
+	cases := []struct {
+		name   string
+		t1     time.Duration
+		t2     time.Duration
+		t3     time.Duration
+		offset time.Duration
+		rtt    time.Duration
+	}{
+		// the agent is 1s ahead, 10ms each way and 5ms in the agent
+		{"ahead", time.Second + 10*time.Millisecond, time.Second + 15*time.Millisecond, 25 * time.Millisecond, time.Second, 20 * time.Millisecond},
+		{"behind", -time.Second + 10*time.Millisecond, -time.Second + 15*time.Millisecond, 25 * time.Millisecond, -time.Second, 20 * time.Millisecond},
+		// the request takes 30ms and the reply 10ms, which is off by half the difference
+		{"asymmetric", 30 * time.Millisecond, 30 * time.Millisecond, 40 * time.Millisecond, 10 * time.Millisecond, 40 * time.Millisecond},
+		{"same clock", 0, 0, 0, 0, 0},
+	}
+	for _, c := range cases {
+		sample := newClockSample(t0, t0.Add(c.t1), t0.Add(c.t2), t0.Add(c.t3))
+		if sample.Offset != c.offset || sample.RTT != c.rtt {
+			t.Errorf("%s: offset %v, rtt %v, want %v, %v", c.name, sample.Offset, sample.RTT, c.offset, c.rtt)
+		}
+	}
+}
+
+func TestClockFilter(t *testing.T) {
+	var f clockFilter
+	estimate := f.add(clockSample{Offset: 5 * time.Millisecond, RTT: 10 * time.Millisecond})
+	want := clockEstimate{Offset: 5 * time.Millisecond, RTT: 10 * time.Millisecond, ErrorBound: 5 * time.Millisecond, Samples: 1}
+	if estimate != want {
+		t.Errorf("estimate of the first sample = %+v, want %+v", estimate, want)
+	}
+
+	// a sample with a higher RTT does not replace the estimate
+	estimate = f.add(clockSample{Offset: 50 * time.Millisecond, RTT: 100 * time.Millisecond})
+	if estimate.Offset != 5*time.Millisecond || estimate.Samples != 2 {
+		t.Errorf("estimate after a slower sample = %+v, want offset 5ms of 2 samples", estimate)
+	}
+	// the sample with the lowest RTT is chosen
+	estimate = f.add(clockSample{Offset: 3 * time.Millisecond, RTT: 4 * time.Millisecond})
+	want = clockEstimate{Offset: 3 * time.Millisecond, RTT: 4 * time.Millisecond, ErrorBound: 2 * time.Millisecond, Samples: 3}
+	if estimate != want {
+		t.Errorf("estimate after a faster sample = %+v, want %+v", estimate, want)
+	}
+	if f.get() != estimate {
+		t.Errorf("get() = %+v, want %+v", f.get(), estimate)
+	}
+
+	// the fastest sample falls out of the window after clockSamples others
+	for i := 0; i < clockSamples; i++ {
+		estimate = f.add(clockSample{Offset: time.Duration(i) * time.Millisecond, RTT: time.Duration(20+i) * time.Millisecond})
+	}
+	want = clockEstimate{Offset: 0, RTT: 20 * time.Millisecond, ErrorBound: 10 * time.Millisecond, Samples: 3 + clockSamples}
+	if estimate != want {
+		t.Errorf("estimate after the window moved = %+v, want %+v", estimate, want)
+	}
+	if len(f.samples) != clockSamples {
+		t.Errorf("%d samples kept, want %d", len(f.samples), clockSamples)
+	}
+	f.add(clockSample{Offset: time.Second, RTT: time.Second})
+	if estimate := f.get(); estimate.Offset != time.Millisecond || estimate.RTT != 21*time.Millisecond {
+		t.Errorf("estimate after the window moved again = %+v, want the sample of 21ms", estimate)
+	}
+}
+
+// pingService answers the pings with a clock offset from the master, after a delay.
+type pingService struct {
+	offset time.Duration
+	delay  time.Duration
+}
+
+func (s *pingService) Ping(args *agent.PingArgs, reply *agent.PingReply) error {
+	reply.MasterSendTime = args.MasterSendTime
+	reply.AgentReceiveTime = time.Now().Add(s.offset).UnixNano()
+	time.Sleep(s.delay)
+	reply.AgentSendTime = time.Now().Add(s.offset).UnixNano()
+	return nil
+}
+
+func TestPingAgent(t *testing.T) {
+	server := rpc.NewServer()
+	service := &pingService{offset: time.Hour, delay: 20 * time.Millisecond}
+	if err := server.RegisterName("Agent", service); err != nil {
+		t.Fatal(err)
+	}
+	serverConn, clientConn := net.Pipe()
+	go server.ServeConn(serverConn)
+	client := rpc.NewClient(clientConn)
+	defer client.Close()
+
+	start := time.Now()
+	sample, err := pingAgent(&AgentProxy{Client: client})
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the time spent in the agent is not part of the round trip, and the offset is within half of it
+	if sample.RTT < 0 || sample.RTT > elapsed-service.delay {
+		t.Errorf("rtt %v, want within [0, %v]", sample.RTT, elapsed-service.delay)
+	}
+	if diff := sample.Offset - service.offset; diff > sample.RTT/2 || diff < -sample.RTT/2 {
+		t.Errorf("offset %v, want %v +/- %v", sample.Offset, service.offset, sample.RTT/2)
+	}
+}
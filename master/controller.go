@@ -2,6 +2,7 @@ package master
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"log"
 	"math"
@@ -14,11 +15,13 @@ import (
 	"strings"
 	"sync"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"aspnet.com/agent"
 	"aspnet.com/benchmark"
 	"aspnet.com/metrics"
+	"aspnet.com/util"
 )
 
 const (
@@ -30,6 +33,8 @@ type AgentProxy struct {
 	Role    string
 	Address string
 	Client  *rpc.Client
+
+	clock clockFilter
 }
 
 func NewAgentProxy(address, role string) (*AgentProxy, error) {
@@ -55,8 +60,17 @@ type agentMetrics struct {
 	AgentRole string
 }
 
+// agentCounters are the counters collected from a single agent.
+type agentCounters struct {
+	Counters  *util.MetricsSnapshot
+	Agent     string
+	AgentRole string
+	Clock     clockEstimate
+}
+
 type SnapshotWriter interface {
-	WriteCounters(now time.Time, counters map[string]int64) error
+	// WriteCounters writes the counters collected at now. window is nil for the first collection.
+	WriteCounters(now time.Time, counters *util.MetricsSnapshot, agents []agentCounters, window *countersWindow) error
 	WriteMetrics(now time.Time, metrics []agentMetrics) error
 }
 
@@ -106,31 +120,106 @@ func (c *Controller) setupAgents(config *benchmark.Config) error {
 	return nil
 }
 
-func (c *Controller) collectCounters() map[string]int64 {
-	resultsChan := make(chan map[string]int64, len(c.Agents))
-	for _, agent := range c.Agents {
-		go func(agent *AgentProxy) {
-			result := make(map[string]int64)
-			if err := agent.Client.Call("Agent.CollectCounters", &struct{}{}, &result); err != nil {
+// collectCounters returns the counters aggregated from all the agents, as well as the counters of each agent
+// in the order of c.Agents.
+func (c *Controller) collectCounters() (*util.MetricsSnapshot, []agentCounters) {
+	agents := make([]agentCounters, len(c.Agents))
+	var wg sync.WaitGroup
+	for i, agent := range c.Agents {
+		wg.Add(1)
+		go func(i int, agent *AgentProxy) {
+			defer wg.Done()
+			result := util.NewMetricsSnapshot()
+			if err := agent.Client.Call("Agent.CollectCounters", &struct{}{}, result); err != nil {
 				log.Println("ERROR: Failed to list counters from agent: ", agent.Address, err)
 			}
-			resultsChan <- result
-		}(agent)
+			agents[i] = agentCounters{
+				Counters:  result,
+				Agent:     agent.Name,
+				AgentRole: agent.Role,
+				Clock:     agent.clock.get(),
+			}
+		}(i, agent)
+	}
+	wg.Wait()
+
+	counters := util.NewMetricsSnapshot()
+	for _, a := range agents {
+		counters.Merge(a.Counters)
+	}
+	return counters, agents
+}
+
+// latencySummary computes the percentiles and basic statistics of a latency histogram.
+func latencySummary(h *util.Histogram) map[string]int64 {
+	summary := h.Percentiles(util.LatencyPercentiles)
+	summary["count"] = h.Count
+	summary["min"] = h.Min
+	summary["max"] = h.Max
+	summary["mean"] = int64(h.Mean())
+	return summary
+}
+
+func (c *Controller) printHistograms(title string, histograms map[string]*util.Histogram) {
+	names := make([]string, 0, len(histograms))
+	for k := range histograms {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	log.Println(title)
+	for _, name := range names {
+		h := histograms[name]
+		percentiles := make([]string, 0, len(util.LatencyPercentiles))
+		for _, p := range util.LatencyPercentiles {
+			percentiles = append(percentiles, fmt.Sprintf("%s=%d", util.PercentileName(p), h.Percentile(p)))
+		}
+		log.Printf("     %s : count=%d mean=%.2f %s max=%d\n", name, h.Count, h.Mean(), strings.Join(percentiles, " "), h.Max)
+	}
+}
+
+// histogramTitles are the titles and the units of the histogram kinds, in the order they are printed.
+var histogramTitles = []struct {
+	kind  string
+	title string
+	unit  string
+}{
+	{benchmark.HistogramLatency, "Latency", "us"},
+	{benchmark.HistogramSize, "Size", "bytes"},
+	{benchmark.HistogramRate, "Rate", "per second"},
+}
+
+// splitHistograms groups the histograms by their kinds.
+func splitHistograms(histograms map[string]*util.Histogram) map[string]map[string]*util.Histogram {
+	groups := make(map[string]map[string]*util.Histogram)
+	for k, h := range histograms {
+		kind := benchmark.HistogramKind(k)
+		if groups[kind] == nil {
+			groups[kind] = make(map[string]*util.Histogram)
+		}
+		groups[kind][k] = h
 	}
-	counters := make(map[string]int64)
-	for i := 0; i < len(c.Agents); i++ {
-		result := <-resultsChan
-		for k, v := range result {
-			counters[k] += v
+	return groups
+}
+
+// printHistogramGroups prints the histograms by kind, the latency always and the others if any.
+// The title of each kind is made by title from its name and unit, e.g. "Latency" and "us".
+func (c *Controller) printHistogramGroups(title func(name string, unit string) string, histograms map[string]*util.Histogram) {
+	groups := splitHistograms(histograms)
+	for _, t := range histogramTitles {
+		if t.kind == benchmark.HistogramLatency || len(groups[t.kind]) > 0 {
+			c.printHistograms(title(t.title, t.unit), groups[t.kind])
 		}
 	}
-	return counters
 }
 
-func (c *Controller) printCounters(counters map[string]int64) {
-	table := make([][2]string, 0, len(counters))
-	for k, v := range counters {
-		table = append(table, [2]string{k, strconv.FormatInt(v, 10)})
+func (c *Controller) printCounters(counters *util.MetricsSnapshot) {
+	table := make([][3]string, 0, len(counters.Counters)+len(counters.Gauges))
+	for k, v := range counters.Counters {
+		table = append(table, [3]string{k, strconv.FormatInt(v, 10), string(util.MetricCounter)})
+	}
+	for k, v := range counters.Gauges {
+		table = append(table, [3]string{k, strconv.FormatInt(v, 10), string(util.MetricGauge)})
 	}
 
 	sort.Slice(table, func(i, j int) bool {
@@ -139,10 +228,74 @@ func (c *Controller) printCounters(counters map[string]int64) {
 
 	log.Println("Counters:")
 	for _, row := range table {
-		log.Println("    ", row[0], ": ", row[1])
+		log.Println("    ", row[0], ": ", row[1], "("+row[2]+")")
+	}
+
+	c.printHistogramGroups(func(name string, unit string) string {
+		return fmt.Sprintf("%s (%s):", name, unit)
+	}, counters.Histograms)
+}
+
+// printAgentCounters prints the counters and gauges side by side for every agent,
+// followed by the latency percentiles of each agent.
+func (c *Controller) printAgentCounters(agents []agentCounters) {
+	names := make(map[string]bool)
+	for _, a := range agents {
+		for k := range a.Counters.Counters {
+			names[k] = true
+		}
+		for k := range a.Counters.Gauges {
+			names[k] = true
+		}
+	}
+	sortedNames := make([]string, 0, len(names))
+	for k := range names {
+		sortedNames = append(sortedNames, k)
+	}
+	sort.Strings(sortedNames)
+
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(w, "\t")
+	for _, a := range agents {
+		fmt.Fprintf(w, "%s(%s)\t", a.Agent, a.AgentRole)
+	}
+	fmt.Fprintln(w)
+	for _, name := range sortedNames {
+		fmt.Fprintf(w, "%s\t", name)
+		for _, a := range agents {
+			fmt.Fprintf(w, "%d\t", a.Counters.Value(name))
+		}
+		fmt.Fprintln(w)
+	}
+	w.Flush()
+
+	log.Println("Counters per agent:")
+	for _, line := range strings.Split(strings.TrimRight(buf.String(), "\n"), "\n") {
+		log.Println("    ", line)
+	}
+
+	for _, a := range agents {
+		log.Printf("Clock of %s (%s): offset %v (+/- %v), rtt %v\n", a.Agent, a.AgentRole, a.Clock.Offset, a.Clock.ErrorBound, a.Clock.RTT)
+		c.printHistogramGroups(func(name string, unit string) string {
+			return fmt.Sprintf("%s (%s) of %s (%s):", name, unit, a.Agent, a.AgentRole)
+		}, a.Counters.Histograms)
 	}
 }
 
+// printResult prints the counters of the "r" command. Run "r agents" to show the counters of each agent as well.
+func (c *Controller) printResult(parts []string) error {
+	if len(parts) > 2 || (len(parts) == 2 && parts[1] != "agents" && parts[1] != "-a") {
+		return fmt.Errorf("SYNTAX: r [agents]")
+	}
+	counters, agents := c.collectCounters()
+	c.printCounters(counters)
+	if len(parts) == 2 {
+		c.printAgentCounters(agents)
+	}
+	return nil
+}
+
 func (c *Controller) collectMetrics(w chan agentMetrics) {
 	var wg sync.WaitGroup
 	for _, agentProxy := range c.Agents {
@@ -184,28 +337,32 @@ func (c *Controller) SplitNumber(total, index int) int {
 }
 
 var csvHeader string
-var counterFields = []string{
-	"connection:inprogress",
-	"connection:established",
-	"connection:closed",
-	"connection:error",
-	"connection:groupjoin",
-	"message:lt:100",
-	"message:lt:200",
-	"message:lt:300",
-	"message:lt:400",
-	"message:lt:500",
-	"message:lt:600",
-	"message:lt:700",
-	"message:lt:800",
-	"message:lt:900",
-	"message:lt:1000",
-	"message:ge:1000",
-	"message:sent",
-	"message:received",
-	"message:send_error",
-	"message:receive_error",
-	"message:decode_error",
+var counterFields []string
+
+// initCounterFields builds the CSV fields with the latency buckets configured for the benchmark.
+func initCounterFields(latencyBuckets []int64) {
+	counterFields = []string{
+		"connection:inprogress",
+		"connection:established",
+		"connection:closed",
+		"connection:error",
+		"connection:groupjoin",
+	}
+	counterFields = append(counterFields, benchmark.LatencyBucketNames("message", latencyBuckets)...)
+	counterFields = append(counterFields,
+		"message:sent",
+		"message:received",
+		"message:send_error",
+		"message:receive_error",
+		"message:decode_error",
+	)
+
+	headers := make([]string, len(counterFields))
+	for i, field := range counterFields {
+		parts := strings.SplitN(field, ":", 2)
+		headers[i] = parts[1]
+	}
+	csvHeader = strings.Join(headers, ",")
 }
 
 var globalChannels []chan struct{}
@@ -260,10 +417,10 @@ func (c *Controller) closeConnection() error {
 	return c.connect(values)
 }
 
-func formatCSVRecord(counters map[string]int64) string {
+func formatCSVRecord(counters *util.MetricsSnapshot) string {
 	values := make([]string, len(counterFields))
 	for i, field := range counterFields {
-		values[i] = strconv.FormatInt(counters[field], 10)
+		values[i] = strconv.FormatInt(counters.Value(field), 10)
 	}
 	return strings.Join(values, ",")
 }
@@ -285,9 +442,9 @@ func (c *Controller) doInvoke(command string, arguments ...string) error {
 func (c *Controller) watchCounters(config *benchmark.Config) {
 	stopWatchCounterChan := make(chan struct{})
 	registerStopChannels(stopWatchCounterChan)
-	go c.watchCountersInternal(stopWatchCounterChan, func(counters map[string]int64) error {
+	go c.watchCountersInternal(stopWatchCounterChan, func(now time.Time, counters *util.MetricsSnapshot, agents []agentCounters, window *countersWindow) error {
 		for _, writer := range c.SnapshotWriters {
-			if err := writer.WriteCounters(time.Now(), counters); err != nil {
+			if err := writer.WriteCounters(now, counters, agents, window); err != nil {
 				log.Println("Error: fail to write counter snapshot: ", err)
 				return err
 			}
@@ -296,15 +453,21 @@ func (c *Controller) watchCounters(config *benchmark.Config) {
 	})
 }
 
-func (c *Controller) watchCountersInternal(stopChan chan struct{}, snapshotWriter func(map[string]int64) error) {
+func (c *Controller) watchCountersInternal(stopChan chan struct{}, snapshotWriter func(time.Time, *util.MetricsSnapshot, []agentCounters, *countersWindow) error) {
 	ticker := time.NewTicker(time.Second)
 	defer ticker.Stop()
+	var prev *util.MetricsSnapshot
+	var prevTime time.Time
 	for {
 		select {
 		case <-ticker.C:
-			counters := c.collectCounters()
-			snapshotWriter(counters)
+			now := time.Now()
+			counters, agents := c.collectCounters()
+			window := computeWindow(prev, counters, now.Sub(prevTime))
+			prev, prevTime = counters, now
+			snapshotWriter(now, counters, agents, window)
 			c.printCounters(counters)
+			c.printWindow(window)
 		case <-stopChan:
 			return
 		}
@@ -401,7 +564,11 @@ func (c *Controller) batchRun(config *benchmark.Config) error {
 		}
 		switch parts[0] {
 		case "r", "result":
-			c.printCounters(c.collectCounters())
+			err = c.printResult(parts)
+			if err != nil {
+				fmt.Println(err)
+				return err
+			}
 		case "cm", "ClearMessage":
 			c.doInvoke("Clear", "message")
 		case "wr", "WatchResult":
@@ -426,6 +593,42 @@ func (c *Controller) batchRun(config *benchmark.Config) error {
 				fmt.Println(err)
 				return err
 			}
+		case "s-rate", "SendRate":
+			err = c.sendRate(parts, "SendRate")
+			if err != nil {
+				fmt.Println(err)
+				return err
+			}
+		case "gs-rate", "GroupSendRate":
+			err = c.sendRate(parts, "GroupSendRate")
+			if err != nil {
+				fmt.Println(err)
+				return err
+			}
+		case "st", "Stream":
+			err = c.stream(parts)
+			if err != nil {
+				fmt.Println(err)
+				return err
+			}
+		case "st-cancel", "CancelStream":
+			err = c.cancelStream(parts)
+			if err != nil {
+				fmt.Println(err)
+				return err
+			}
+		case "up", "Upload":
+			err = c.upload(parts)
+			if err != nil {
+				fmt.Println(err)
+				return err
+			}
+		case "rest", "RestSend":
+			err = c.restSend(parts)
+			if err != nil {
+				fmt.Println(err)
+				return err
+			}
 		case "wc", "WaitAndContinue":
 			err = c.waitTimeoutOrComplete(parts, false)
 			if err != nil {
@@ -478,7 +681,11 @@ func (c *Controller) interactiveRun() error {
 		}
 		switch parts[0] {
 		case "r", "result":
-			c.printCounters(c.collectCounters())
+			err = c.printResult(parts)
+			if err != nil {
+				fmt.Println(err)
+				break
+			}
 		// case "m", "metrics":
 		// 	c.printMetrics(c.collectMetrics())
 		case "v":
@@ -501,6 +708,42 @@ func (c *Controller) interactiveRun() error {
 				fmt.Println(err)
 				break
 			}
+		case "s-rate", "SendRate":
+			err = c.sendRate(parts, "SendRate")
+			if err != nil {
+				fmt.Println(err)
+				break
+			}
+		case "gs-rate", "GroupSendRate":
+			err = c.sendRate(parts, "GroupSendRate")
+			if err != nil {
+				fmt.Println(err)
+				break
+			}
+		case "st", "Stream":
+			err = c.stream(parts)
+			if err != nil {
+				fmt.Println(err)
+				break
+			}
+		case "st-cancel", "CancelStream":
+			err = c.cancelStream(parts)
+			if err != nil {
+				fmt.Println(err)
+				break
+			}
+		case "up", "Upload":
+			err = c.upload(parts)
+			if err != nil {
+				fmt.Println(err)
+				break
+			}
+		case "rest", "RestSend":
+			err = c.restSend(parts)
+			if err != nil {
+				fmt.Println(err)
+				break
+			}
 		case "jg", "JoinGroup":
 			err = c.joinGroup(parts)
 			if err != nil {
@@ -533,7 +776,7 @@ func (c *Controller) clearAndWaitAndDump(secWait int) {
 	c.doInvoke("Clear", "message")
 	time.Sleep(time.Duration(secWait) * time.Second)
 	fmt.Println(csvHeader)
-	counters := c.collectCounters()
+	counters, _ := c.collectCounters()
 	fmt.Println(formatCSVRecord(counters))
 }
 
@@ -654,11 +897,163 @@ func (c *Controller) internalSend(parts []string, cmd string) error {
 	return nil
 }
 
+// sendRate makes every agent send messages at the given rate per second spread over its share of the clients.
+func (c *Controller) sendRate(parts []string, cmd string) error {
+	partsLen := len(parts)
+	if partsLen < 2 || partsLen > 3 {
+		return fmt.Errorf("SYNTAX: %s <messages_per_second_per_agent> [clients]", parts[0])
+	}
+	rate, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return fmt.Errorf("ERROR: %v", err)
+	}
+	if rate < 0 {
+		return fmt.Errorf("ERROR: rate is negative")
+	}
+	clients := math.MaxInt32
+	if partsLen >= 3 {
+		clients, err = strconv.Atoi(parts[2])
+		if err != nil {
+			return fmt.Errorf("ERROR: %v", err)
+		}
+	}
+	if clients < 0 {
+		clients = math.MaxInt32
+	}
+	for i, agentProxy := range c.clientAgents() {
+		agentClients := c.SplitNumber(clients, i)
+		err := agentProxy.Client.Call("Agent.Invoke", &agent.Invocation{
+			Command:   cmd,
+			Arguments: []string{strconv.Itoa(agentClients), strconv.Itoa(rate)},
+		}, nil)
+		if err != nil {
+			return fmt.Errorf("ERROR[%s]: %v\n", agentProxy.Address, err)
+		}
+	}
+	return nil
+}
+
+// stream makes the clients, split over the agents, start streams from the server.
+func (c *Controller) stream(parts []string) error {
+	partsLen := len(parts)
+	if partsLen < 4 || partsLen > 5 {
+		return fmt.Errorf("SYNTAX: st <clients> <streams_per_client> <items_per_stream> [item_interval_millis]")
+	}
+	args := make([]int, 4)
+	args[3] = 1000
+	for i := 1; i < partsLen; i++ {
+		n, err := strconv.Atoi(parts[i])
+		if err != nil {
+			return fmt.Errorf("ERROR: %v", err)
+		}
+		if n < 0 {
+			return fmt.Errorf("ERROR: %s is negative", parts[i])
+		}
+		args[i-1] = n
+	}
+	for i, agentProxy := range c.clientAgents() {
+		err := agentProxy.Client.Call("Agent.Invoke", &agent.Invocation{
+			Command: "Stream",
+			Arguments: []string{strconv.Itoa(c.SplitNumber(args[0], i)), strconv.Itoa(args[1]),
+				strconv.Itoa(args[2]), strconv.Itoa(args[3])},
+		}, nil)
+		if err != nil {
+			return fmt.Errorf("ERROR[%s]: %v\n", agentProxy.Address, err)
+		}
+	}
+	return nil
+}
+
+// cancelStream cancels the active streams, split over the agents.
+func (c *Controller) cancelStream(parts []string) error {
+	if len(parts) != 2 {
+		return fmt.Errorf("SYNTAX: st-cancel <streams>")
+	}
+	streams, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return fmt.Errorf("ERROR: %v", err)
+	}
+	if streams < 0 {
+		streams = math.MaxInt32
+	}
+	for i, agentProxy := range c.clientAgents() {
+		err := agentProxy.Client.Call("Agent.Invoke", &agent.Invocation{
+			Command:   "CancelStream",
+			Arguments: []string{strconv.Itoa(c.SplitNumber(streams, i))},
+		}, nil)
+		if err != nil {
+			return fmt.Errorf("ERROR[%s]: %v\n", agentProxy.Address, err)
+		}
+	}
+	return nil
+}
+
+// upload makes the clients, split over the agents, upload streams to the server.
+func (c *Controller) upload(parts []string) error {
+	if len(parts) != 5 {
+		return fmt.Errorf("SYNTAX: up <clients> <items_per_stream> <items_per_second> <item_size>")
+	}
+	args := make([]int, 4)
+	for i := 1; i < len(parts); i++ {
+		n, err := strconv.Atoi(parts[i])
+		if err != nil {
+			return fmt.Errorf("ERROR: %v", err)
+		}
+		if n < 0 {
+			return fmt.Errorf("ERROR: %s is negative", parts[i])
+		}
+		args[i-1] = n
+	}
+	if args[2] == 0 {
+		return fmt.Errorf("ERROR: items_per_second must be positive")
+	}
+	for i, agentProxy := range c.clientAgents() {
+		err := agentProxy.Client.Call("Agent.Invoke", &agent.Invocation{
+			Command: "Upload",
+			Arguments: []string{strconv.Itoa(c.SplitNumber(args[0], i)), strconv.Itoa(args[1]),
+				strconv.Itoa(args[2]), strconv.Itoa(args[3])},
+		}, nil)
+		if err != nil {
+			return fmt.Errorf("ERROR[%s]: %v\n", agentProxy.Address, err)
+		}
+	}
+	return nil
+}
+
+// restSend makes every agent publish messages with the REST API of SignalR Service at the given rate per second.
+func (c *Controller) restSend(parts []string) error {
+	if len(parts) != 3 {
+		return fmt.Errorf("SYNTAX: rest <broadcast|users|groups> <messages_per_second_per_agent>")
+	}
+	rate, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return fmt.Errorf("ERROR: %v", err)
+	}
+	if rate < 0 {
+		return fmt.Errorf("ERROR: rate is negative")
+	}
+	for _, agentProxy := range c.clientAgents() {
+		err := agentProxy.Client.Call("Agent.Invoke", &agent.Invocation{
+			Command:   "RestSend",
+			Arguments: []string{parts[1], strconv.Itoa(rate)},
+		}, nil)
+		if err != nil {
+			return fmt.Errorf("ERROR[%s]: %v\n", agentProxy.Address, err)
+		}
+	}
+	return nil
+}
+
 func (c *Controller) Run(config *benchmark.Config) error {
+	initCounterFields(config.LatencyBuckets)
+
 	if err := c.setupAgents(config); err != nil {
 		return err
 	}
 
+	c.syncClocks(true)
+	c.watchClocks()
+
 	sig := make(chan os.Signal, 2)
 	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
 	go func() {
@@ -676,10 +1071,5 @@ func (c *Controller) Run(config *benchmark.Config) error {
 }
 
 func init() {
-	headers := make([]string, len(counterFields))
-	for i, field := range counterFields {
-		parts := strings.SplitN(field, ":", 2)
-		headers[i] = parts[1]
-	}
-	csvHeader = strings.Join(headers, ",")
+	initCounterFields(nil)
 }
@@ -4,7 +4,9 @@ import (
 	"log"
 	"time"
 
+	"aspnet.com/benchmark"
 	"aspnet.com/metrics"
+	"aspnet.com/util"
 
 	"github.com/influxdata/influxdb/client/v2"
 )
@@ -26,7 +28,84 @@ func NewInfluxDBSnapshotWriter(addr, db string) *InfluxDBSnapshotWriter {
 	}
 }
 
-func (w *InfluxDBSnapshotWriter) WriteCounters(now time.Time, counters map[string]int64) error {
+// addCounters adds counters, gauges and latency histograms to the "<prefix>counters", "<prefix>gauges"
+// and "<prefix>latency" measurements respectively, and the size and rate histograms to "<prefix>size" and "<prefix>rate".
+func addCounters(bp client.BatchPoints, counters *util.MetricsSnapshot, now time.Time, prefix string, commonTags map[string]string) error {
+	for measurement, values := range map[string]map[string]int64{
+		prefix + "counters": counters.Counters,
+		prefix + "gauges":   counters.Gauges,
+	} {
+		if len(values) == 0 {
+			continue
+		}
+		fields := make(map[string]interface{})
+		for k, v := range values {
+			fields[k] = v
+		}
+		pt, err := client.NewPoint(measurement, commonTags, fields, now)
+		if err != nil {
+			return err
+		}
+		bp.AddPoint(pt)
+	}
+
+	for k, h := range counters.Histograms {
+		fields := make(map[string]interface{})
+		for name, v := range latencySummary(h) {
+			fields[name] = v
+		}
+		tags := map[string]string{
+			"series": k,
+		}
+		for k, v := range commonTags {
+			tags[k] = v
+		}
+		pt, err := client.NewPoint(prefix+benchmark.HistogramKind(k), tags, fields, now)
+		if err != nil {
+			return err
+		}
+		bp.AddPoint(pt)
+	}
+	return nil
+}
+
+// addWindow adds the per second rates to the "rates" measurement and the histograms within the window
+// to the "window_latency", "window_size" and "window_rate" measurements.
+func addWindow(bp client.BatchPoints, window *countersWindow, now time.Time) error {
+	if len(window.Rates) > 0 {
+		fields := make(map[string]interface{})
+		for k, v := range window.Rates {
+			fields[k] = v
+		}
+		if window.Expected > 0 {
+			fields["message:completeness"] = window.Completeness
+		}
+		pt, err := client.NewPoint("rates", map[string]string{}, fields, now)
+		if err != nil {
+			return err
+		}
+		bp.AddPoint(pt)
+	}
+
+	for k, h := range window.Histograms {
+		fields := make(map[string]interface{})
+		for name, v := range latencySummary(h) {
+			fields[name] = v
+		}
+		pt, err := client.NewPoint("window_"+benchmark.HistogramKind(k), map[string]string{"series": k}, fields, now)
+		if err != nil {
+			return err
+		}
+		bp.AddPoint(pt)
+	}
+	return nil
+}
+
+// WriteCounters writes the aggregated counters to the "counters", "gauges" and "latency" measurements,
+// and the counters of each agent to "agent_counters", "agent_gauges" and "agent_latency" tagged by the agent,
+// as well as the clock estimate of the agent to "agent_clock".
+// The window, if any, goes to "rates" and "window_latency".
+func (w *InfluxDBSnapshotWriter) WriteCounters(now time.Time, counters *util.MetricsSnapshot, agents []agentCounters, window *countersWindow) error {
 	bp, err := client.NewBatchPoints(client.BatchPointsConfig{
 		Database:  w.db,
 		Precision: "s",
@@ -35,16 +114,36 @@ func (w *InfluxDBSnapshotWriter) WriteCounters(now time.Time, counters map[strin
 		return err
 	}
 
-	tags := map[string]string{}
-	fields := make(map[string]interface{})
-	for k, v := range counters {
-		fields[k] = v
-	}
-	pt, err := client.NewPoint("counters", tags, fields, now)
-	if err != nil {
+	if err = addCounters(bp, counters, now, "", map[string]string{}); err != nil {
 		return err
 	}
-	bp.AddPoint(pt)
+
+	for _, a := range agents {
+		commonTags := map[string]string{
+			"agent":     a.Agent,
+			"agentRole": a.AgentRole,
+		}
+		if err = addCounters(bp, a.Counters, now, "agent_", commonTags); err != nil {
+			return err
+		}
+
+		fields := map[string]interface{}{
+			"offsetMicros":     int64(a.Clock.Offset / time.Microsecond),
+			"errorBoundMicros": int64(a.Clock.ErrorBound / time.Microsecond),
+			"rttMicros":        int64(a.Clock.RTT / time.Microsecond),
+		}
+		pt, err := client.NewPoint("agent_clock", commonTags, fields, now)
+		if err != nil {
+			return err
+		}
+		bp.AddPoint(pt)
+	}
+
+	if window != nil {
+		if err = addWindow(bp, window, now); err != nil {
+			return err
+		}
+	}
 
 	if err = w.client.Write(bp); err != nil {
 		return err
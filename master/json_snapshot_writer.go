@@ -4,6 +4,9 @@ import (
 	"encoding/json"
 	"os"
 	"time"
+
+	"aspnet.com/benchmark"
+	"aspnet.com/util"
 )
 
 type JsonSnapshotWriter struct {
@@ -16,9 +19,65 @@ func NewJsonSnapshotWriter(outDir string) *JsonSnapshotWriter {
 	}
 }
 
+// JsonSnapshotCountersRow is a row of counters.txt. Counters and Gauges are kept apart
+// so that readers know which values can be turned into rates.
 type JsonSnapshotCountersRow struct {
 	Time     string
 	Counters map[string]int64
+	Gauges   map[string]int64
+	Latency  map[string]map[string]int64 `json:",omitempty"`
+	Sizes    map[string]map[string]int64 `json:",omitempty"`
+	Rate     map[string]map[string]int64 `json:",omitempty"`
+	Agents   []JsonSnapshotAgentCounters `json:",omitempty"`
+	Window   *JsonSnapshotWindow         `json:",omitempty"`
+}
+
+// JsonSnapshotWindow is the change since the previous row: per second rates, deltas and the histograms within.
+// Rate, like in the other rows, is the histograms of rates, e.g. the items per second of each stream.
+type JsonSnapshotWindow struct {
+	IntervalSeconds float64
+	Rates           map[string]float64
+	Deltas          map[string]int64
+	Latency         map[string]map[string]int64 `json:",omitempty"`
+	Sizes           map[string]map[string]int64 `json:",omitempty"`
+	Rate            map[string]map[string]int64 `json:",omitempty"`
+	// Expected and Completeness are the messages expected to be received and the ratio received, if any.
+	Expected     int64   `json:",omitempty"`
+	Completeness float64 `json:",omitempty"`
+}
+
+// JsonSnapshotAgentCounters holds the counters of a single agent in a counters row,
+// together with the estimated offset of the agent clock to the master clock.
+type JsonSnapshotAgentCounters struct {
+	Agent     string
+	AgentRole string
+	Counters  map[string]int64
+	Gauges    map[string]int64
+	Latency   map[string]map[string]int64 `json:",omitempty"`
+	Sizes     map[string]map[string]int64 `json:",omitempty"`
+	Rate      map[string]map[string]int64 `json:",omitempty"`
+
+	ClockOffsetMicros     int64
+	ClockErrorBoundMicros int64
+	ClockRTTMicros        int64
+}
+
+func latencySummaries(histograms map[string]*util.Histogram) map[string]map[string]int64 {
+	if len(histograms) == 0 {
+		return nil
+	}
+	summaries := make(map[string]map[string]int64, len(histograms))
+	for k, h := range histograms {
+		summaries[k] = latencySummary(h)
+	}
+	return summaries
+}
+
+// histogramSummaries summarizes the latency, the size and the rate histograms apart.
+func histogramSummaries(histograms map[string]*util.Histogram) (latency, sizes, rates map[string]map[string]int64) {
+	groups := splitHistograms(histograms)
+	return latencySummaries(groups[benchmark.HistogramLatency]), latencySummaries(groups[benchmark.HistogramSize]),
+		latencySummaries(groups[benchmark.HistogramRate])
 }
 
 func (w *JsonSnapshotWriter) writeRow(filename string, data []byte) error {
@@ -35,10 +94,38 @@ func (w *JsonSnapshotWriter) writeRow(filename string, data []byte) error {
 	return nil
 }
 
-func (w *JsonSnapshotWriter) WriteCounters(now time.Time, counters map[string]int64) error {
+func (w *JsonSnapshotWriter) WriteCounters(now time.Time, counters *util.MetricsSnapshot, agents []agentCounters, window *countersWindow) error {
 	row := &JsonSnapshotCountersRow{
 		Time:     time.Now().Format(time.RFC3339),
-		Counters: counters,
+		Counters: counters.Counters,
+		Gauges:   counters.Gauges,
+	}
+	row.Latency, row.Sizes, row.Rate = histogramSummaries(counters.Histograms)
+	for _, a := range agents {
+		latency, sizes, rates := histogramSummaries(a.Counters.Histograms)
+		row.Agents = append(row.Agents, JsonSnapshotAgentCounters{
+			Agent:     a.Agent,
+			AgentRole: a.AgentRole,
+			Counters:  a.Counters.Counters,
+			Gauges:    a.Counters.Gauges,
+			Latency:   latency,
+			Sizes:     sizes,
+			Rate:      rates,
+
+			ClockOffsetMicros:     int64(a.Clock.Offset / time.Microsecond),
+			ClockErrorBoundMicros: int64(a.Clock.ErrorBound / time.Microsecond),
+			ClockRTTMicros:        int64(a.Clock.RTT / time.Microsecond),
+		})
+	}
+	if window != nil {
+		row.Window = &JsonSnapshotWindow{
+			IntervalSeconds: window.Interval.Seconds(),
+			Rates:           window.Rates,
+			Deltas:          window.Deltas,
+			Expected:        window.Expected,
+			Completeness:    window.Completeness,
+		}
+		row.Window.Latency, row.Window.Sizes, row.Window.Rate = histogramSummaries(window.Histograms)
 	}
 	data, err := json.Marshal(row)
 	if err != nil {
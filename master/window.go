@@ -0,0 +1,101 @@
+package master
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"aspnet.com/util"
+)
+
+// countersWindow is the change of the counters between two consecutive collections,
+// so that the current throughput and latency can be told apart from the totals since the start.
+type countersWindow struct {
+	Interval time.Duration
+	// Deltas and Rates (per second) are computed for every counter and for the connection:* gauges.
+	Deltas map[string]int64
+	Rates  map[string]float64
+	// Histograms holds the values recorded within the window.
+	Histograms map[string]*util.Histogram
+	// Expected is the number of messages expected to be received within the window, and Completeness is
+	// the ratio of the messages received to it. Both are 0 if no message is expected.
+	Expected     int64
+	Completeness float64
+}
+
+// expectedMessages returns the messages expected to be received for the deltas of the messages sent:
+// message:expected is counted by the agents from the fan-out they know, while every message:broadcast
+// is expected to be received by all the connections of all the agents.
+func expectedMessages(deltas map[string]int64, cur *util.MetricsSnapshot) int64 {
+	return deltas["message:expected"] + deltas["message:broadcast"]*cur.Gauges["connection:established"]
+}
+
+// isRateGauge tells whether the delta of a gauge is meaningful as a rate, e.g. connections per second.
+func isRateGauge(name string) bool {
+	return strings.HasPrefix(name, "connection:")
+}
+
+// computeWindow returns the window from prev to cur, or nil if there is no previous collection.
+// A counter that went down is considered to be cleared, so its delta is its current value.
+func computeWindow(prev, cur *util.MetricsSnapshot, interval time.Duration) *countersWindow {
+	if prev == nil || interval <= 0 {
+		return nil
+	}
+	window := &countersWindow{
+		Interval:   interval,
+		Deltas:     make(map[string]int64),
+		Rates:      make(map[string]float64),
+		Histograms: make(map[string]*util.Histogram),
+	}
+	seconds := interval.Seconds()
+	for k, v := range cur.Counters {
+		delta := v - prev.Counters[k]
+		if delta < 0 {
+			delta = v
+		}
+		window.Deltas[k] = delta
+		window.Rates[k] = float64(delta) / seconds
+	}
+	for k, v := range cur.Gauges {
+		if !isRateGauge(k) {
+			continue
+		}
+		delta := v - prev.Gauges[k]
+		window.Deltas[k] = delta
+		window.Rates[k] = float64(delta) / seconds
+	}
+	for k, h := range cur.Histograms {
+		window.Histograms[k] = h.Sub(prev.Histograms[k])
+	}
+	window.Expected = expectedMessages(window.Deltas, cur)
+	if window.Expected > 0 {
+		window.Completeness = float64(window.Deltas["message:received"]) / float64(window.Expected)
+	}
+	return window
+}
+
+func (c *Controller) printWindow(window *countersWindow) {
+	if window == nil {
+		return
+	}
+	names := make([]string, 0, len(window.Rates))
+	for k := range window.Rates {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	log.Printf("Rates (per second, last %.2fs):\n", window.Interval.Seconds())
+	for _, name := range names {
+		log.Println("    ", name, ": ", fmt.Sprintf("%.2f/s (%+d)", window.Rates[name], window.Deltas[name]))
+	}
+
+	if window.Expected > 0 {
+		log.Printf("Completeness: %.2f%% (%d received / %d expected)\n", window.Completeness*100, window.Deltas["message:received"], window.Expected)
+	}
+
+	c.printHistogramGroups(func(name string, unit string) string {
+		return fmt.Sprintf("%s (%s, last %.2fs):", name, unit, window.Interval.Seconds())
+	}, window.Histograms)
+}
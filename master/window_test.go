@@ -0,0 +1,125 @@
+package master
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"aspnet.com/util"
+)
+
+func TestComputeWindow(t *testing.T) {
+	if window := computeWindow(nil, util.NewMetricsSnapshot(), time.Second); window != nil {
+		t.Errorf("computeWindow without a previous collection = %+v, want nil", window)
+	}
+	if window := computeWindow(util.NewMetricsSnapshot(), util.NewMetricsSnapshot(), 0); window != nil {
+		t.Errorf("computeWindow of an empty interval = %+v, want nil", window)
+	}
+
+	prev := util.NewMetricsSnapshot()
+	prev.Counters["message:sent"] = 100
+	prev.Counters["message:received"] = 50
+	prev.Counters["rest:error"] = 30
+	prev.Gauges["connection:established"] = 10
+	prev.Gauges["connection:reconnecting"] = 4
+	prev.Gauges["rest:outstanding"] = 7
+	prev.Histograms["message:latency"] = util.NewHistogram()
+	prev.Histograms["message:latency"].Record(5)
+
+	cur := util.NewMetricsSnapshot()
+	cur.Counters["message:sent"] = 300
+	cur.Counters["message:received"] = 450
+	// cleared after prev, so its delta is its value
+	cur.Counters["rest:error"] = 3
+	cur.Counters["connection:closed"] = 2
+	cur.Gauges["connection:established"] = 20
+	cur.Gauges["connection:reconnecting"] = 1
+	cur.Gauges["rest:outstanding"] = 9
+	cur.Histograms["message:latency"] = prev.Histograms["message:latency"].Clone()
+	cur.Histograms["message:latency"].Record(5)
+	cur.Histograms["message:latency"].Record(7)
+
+	window := computeWindow(prev, cur, 2*time.Second)
+	wantDeltas := map[string]int64{
+		"message:sent":            200,
+		"message:received":        400,
+		"rest:error":              3,
+		"connection:closed":       2,
+		"connection:established":  10,
+		"connection:reconnecting": -3,
+	}
+	if !reflect.DeepEqual(window.Deltas, wantDeltas) {
+		t.Errorf("Deltas = %v, want %v", window.Deltas, wantDeltas)
+	}
+	wantRates := map[string]float64{
+		"message:sent":            100,
+		"message:received":        200,
+		"rest:error":              1.5,
+		"connection:closed":       1,
+		"connection:established":  5,
+		"connection:reconnecting": -1.5,
+	}
+	if !reflect.DeepEqual(window.Rates, wantRates) {
+		t.Errorf("Rates = %v, want %v", window.Rates, wantRates)
+	}
+	latency := window.Histograms["message:latency"]
+	if latency == nil || latency.Count != 2 || latency.Sum != 12 {
+		t.Errorf("message:latency of the window = %+v, want the 2 values recorded after prev", latency)
+	}
+	if window.Expected != 0 || window.Completeness != 0 {
+		t.Errorf("Expected = %d, Completeness = %f without expected messages, want 0", window.Expected, window.Completeness)
+	}
+}
+
+func TestWindowCompleteness(t *testing.T) {
+	cases := []struct {
+		name         string
+		prev         map[string]int64
+		cur          map[string]int64
+		connections  int64
+		expected     int64
+		completeness float64
+	}{
+		{
+			"expected",
+			map[string]int64{"message:expected": 100, "message:received": 100},
+			map[string]int64{"message:expected": 300, "message:received": 250},
+			10, 200, 0.75,
+		},
+		{
+			"broadcast to every connection",
+			map[string]int64{"message:broadcast": 1},
+			map[string]int64{"message:broadcast": 5, "message:received": 40},
+			10, 40, 1,
+		},
+		{
+			"expected and broadcast",
+			map[string]int64{},
+			map[string]int64{"message:expected": 10, "message:broadcast": 2, "message:received": 15},
+			5, 20, 0.75,
+		},
+		{
+			"cleared counters",
+			map[string]int64{"message:expected": 1000, "message:received": 1000},
+			map[string]int64{"message:expected": 50, "message:received": 50},
+			10, 50, 1,
+		},
+		{
+			"nothing expected",
+			map[string]int64{"message:received": 10},
+			map[string]int64{"message:received": 20},
+			10, 0, 0,
+		},
+	}
+	for _, c := range cases {
+		prev, cur := util.NewMetricsSnapshot(), util.NewMetricsSnapshot()
+		prev.Counters, cur.Counters = c.prev, c.cur
+		prev.Gauges["connection:established"] = c.connections
+		cur.Gauges["connection:established"] = c.connections
+		window := computeWindow(prev, cur, time.Second)
+		if window.Expected != c.expected || window.Completeness != c.completeness {
+			t.Errorf("%s: Expected = %d, Completeness = %f, want %d, %f",
+				c.name, window.Expected, window.Completeness, c.expected, c.completeness)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package util
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// clockOffset is the offset in nanoseconds of the local clock to the reference clock of the master.
+var clockOffset int64
+
+// SetClockOffset sets the offset of the local clock to the reference clock, i.e. local time - reference time.
+func SetClockOffset(offset time.Duration) {
+	atomic.StoreInt64(&clockOffset, int64(offset))
+}
+
+// ClockOffset returns the offset of the local clock to the reference clock.
+func ClockOffset() time.Duration {
+	return time.Duration(atomic.LoadInt64(&clockOffset))
+}
+
+// Now returns the current time of the reference clock, so that timestamps taken on different agents
+// can be compared with each other.
+func Now() time.Time {
+	return time.Now().Add(-ClockOffset())
+}
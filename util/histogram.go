@@ -0,0 +1,209 @@
+package util
+
+import (
+	"math"
+	"math/bits"
+	"sort"
+	"strconv"
+)
+
+// HistogramSubBucketBits controls the precision of the histogram: every power of two range
+// is split into 2^HistogramSubBucketBits linear sub buckets, which bounds the relative error
+// of a recorded value to 1/2^HistogramSubBucketBits (~0.8%).
+const HistogramSubBucketBits = 7
+
+const histogramSubBucketCount = 1 << HistogramSubBucketBits
+
+// LatencyPercentiles are the percentiles reported for every latency histogram.
+var LatencyPercentiles = []float64{50, 90, 99, 99.9}
+
+// Histogram is a log-linear histogram of non-negative int64 values.
+// Buckets are sparse and keyed by bucket index, so histograms recorded on different agents
+// can be serialized through net/rpc and merged on the master without losing precision.
+// Histogram is not thread safe.
+type Histogram struct {
+	Buckets map[int32]int64
+	Count   int64
+	Sum     int64
+	Min     int64
+	Max     int64
+}
+
+func NewHistogram() *Histogram {
+	return &Histogram{
+		Buckets: make(map[int32]int64),
+	}
+}
+
+func histogramBucketIndex(value int64) int32 {
+	v := uint64(value)
+	msb := bits.Len64(v) - 1
+	if msb < HistogramSubBucketBits {
+		return int32(v)
+	}
+	shift := uint(msb - HistogramSubBucketBits)
+	return int32((shift+1)<<HistogramSubBucketBits) + int32(v>>shift) - histogramSubBucketCount
+}
+
+// histogramBucketBounds returns the inclusive lower and upper bound of the values in a bucket.
+func histogramBucketBounds(index int32) (int64, int64) {
+	if index < histogramSubBucketCount {
+		return int64(index), int64(index)
+	}
+	shift := uint(index>>HistogramSubBucketBits) - 1
+	lower := int64(index&(histogramSubBucketCount-1)+histogramSubBucketCount) << shift
+	return lower, lower + (int64(1) << shift) - 1
+}
+
+// Record adds a single value to the histogram. Negative values are recorded as 0.
+func (h *Histogram) Record(value int64) {
+	h.RecordN(value, 1)
+}
+
+// RecordN adds the same value n times to the histogram.
+func (h *Histogram) RecordN(value int64, n int64) {
+	if n <= 0 {
+		return
+	}
+	if value < 0 {
+		value = 0
+	}
+	if h.Buckets == nil {
+		h.Buckets = make(map[int32]int64)
+	}
+	if h.Count == 0 || value < h.Min {
+		h.Min = value
+	}
+	if h.Count == 0 || value > h.Max {
+		h.Max = value
+	}
+	h.Buckets[histogramBucketIndex(value)] += n
+	h.Count += n
+	h.Sum += value * n
+}
+
+// Merge adds all the values recorded in other into h.
+func (h *Histogram) Merge(other *Histogram) {
+	if other == nil || other.Count == 0 {
+		return
+	}
+	if h.Buckets == nil {
+		h.Buckets = make(map[int32]int64)
+	}
+	if h.Count == 0 || other.Min < h.Min {
+		h.Min = other.Min
+	}
+	if h.Count == 0 || other.Max > h.Max {
+		h.Max = other.Max
+	}
+	for k, v := range other.Buckets {
+		h.Buckets[k] += v
+	}
+	h.Count += other.Count
+	h.Sum += other.Sum
+}
+
+// Sub returns the values recorded in h since it was at the state of previous, e.g. the latency
+// of the last interval from two cumulative snapshots. If h was reset after previous, h itself is returned.
+// Min and Max of the result are approximated by the bounds of its lowest and highest buckets.
+func (h *Histogram) Sub(previous *Histogram) *Histogram {
+	if previous == nil || previous.Count == 0 || previous.Count > h.Count {
+		return h.Clone()
+	}
+	delta := NewHistogram()
+	lowest, highest := int32(-1), int32(-1)
+	for k, v := range h.Buckets {
+		n := v - previous.Buckets[k]
+		if n < 0 {
+			// h is not a continuation of previous
+			return h.Clone()
+		}
+		if n == 0 {
+			continue
+		}
+		delta.Buckets[k] = n
+		delta.Count += n
+		if lowest < 0 || k < lowest {
+			lowest = k
+		}
+		if k > highest {
+			highest = k
+		}
+	}
+	if delta.Count == 0 {
+		return delta
+	}
+	delta.Sum = h.Sum - previous.Sum
+	delta.Min, _ = histogramBucketBounds(lowest)
+	_, delta.Max = histogramBucketBounds(highest)
+	if delta.Min < h.Min {
+		delta.Min = h.Min
+	}
+	if delta.Max > h.Max {
+		delta.Max = h.Max
+	}
+	return delta
+}
+
+// Clone returns a deep copy of the histogram.
+func (h *Histogram) Clone() *Histogram {
+	clone := NewHistogram()
+	clone.Merge(h)
+	return clone
+}
+
+// Mean returns the average of all recorded values.
+func (h *Histogram) Mean() float64 {
+	if h.Count == 0 {
+		return 0
+	}
+	return float64(h.Sum) / float64(h.Count)
+}
+
+// Percentile returns the value below which the given percentage (0-100) of values fall.
+// The result is the upper bound of the matching bucket, clamped to the recorded max.
+func (h *Histogram) Percentile(p float64) int64 {
+	if h.Count == 0 {
+		return 0
+	}
+
+	indices := make([]int, 0, len(h.Buckets))
+	for k := range h.Buckets {
+		indices = append(indices, int(k))
+	}
+	sort.Ints(indices)
+
+	target := int64(math.Ceil(p / 100 * float64(h.Count)))
+	if target < 1 {
+		target = 1
+	}
+	var seen int64
+	for _, index := range indices {
+		seen += h.Buckets[int32(index)]
+		if seen >= target {
+			_, upper := histogramBucketBounds(int32(index))
+			if upper > h.Max {
+				upper = h.Max
+			}
+			if upper < h.Min {
+				upper = h.Min
+			}
+			return upper
+		}
+	}
+	return h.Max
+}
+
+// Percentiles computes the given percentiles and names them in the form of "p50", "p99.9".
+func (h *Histogram) Percentiles(ps []float64) map[string]int64 {
+	result := make(map[string]int64, len(ps))
+	for _, p := range ps {
+		result[PercentileName(p)] = h.Percentile(p)
+	}
+	return result
+}
+
+// PercentileName formats a percentile, e.g. 99.9 to "p99.9".
+func PercentileName(p float64) string {
+	return "p" + strconv.FormatFloat(p, 'f', -1, 64)
+}
@@ -0,0 +1,121 @@
+package util
+
+import (
+	"testing"
+)
+
+func TestHistogramBucketBounds(t *testing.T) {
+	for _, value := range []int64{0, 1, 127, 128, 129, 255, 256, 1000, 123456, 1 << 40} {
+		lower, upper := histogramBucketBounds(histogramBucketIndex(value))
+		if value < lower || value > upper {
+			t.Errorf("%d is out of its bucket [%d, %d]", value, lower, upper)
+		}
+		if float64(upper-lower) > float64(value)/histogramSubBucketCount {
+			t.Errorf("bucket [%d, %d] of %d is too wide", lower, upper, value)
+		}
+	}
+}
+
+func TestHistogramPercentile(t *testing.T) {
+	h := NewHistogram()
+	if h.Percentile(99) != 0 {
+		t.Error("percentile of an empty histogram is not 0")
+	}
+	// the values below 128 have their own buckets, so the percentiles are exact
+	for v := int64(1); v <= 100; v++ {
+		h.Record(v)
+	}
+	tests := []struct {
+		p    float64
+		want int64
+	}{
+		{0, 1},
+		{50, 50},
+		{90, 90},
+		{99, 99},
+		{99.9, 100},
+		{100, 100},
+	}
+	for _, test := range tests {
+		if got := h.Percentile(test.p); got != test.want {
+			t.Errorf("p%v = %d, want %d", test.p, got, test.want)
+		}
+	}
+	if h.Mean() != 50.5 {
+		t.Errorf("mean = %v, want 50.5", h.Mean())
+	}
+	if got := h.Percentiles([]float64{50, 99.9}); got["p50"] != 50 || got["p99.9"] != 100 {
+		t.Errorf("percentiles %v", got)
+	}
+}
+
+func TestHistogramPercentileLargeValues(t *testing.T) {
+	h := NewHistogram()
+	for v := int64(1); v <= 10000; v++ {
+		h.Record(v * 1000)
+	}
+	for _, p := range []float64{50, 90, 99} {
+		want := float64(p) * 100 * 1000
+		got := float64(h.Percentile(p))
+		if got < want || got > want*(1+1.0/histogramSubBucketCount) {
+			t.Errorf("p%v = %v, want %v within the bucket precision", p, got, want)
+		}
+	}
+	// the upper bound of the last bucket is clamped to the max
+	if got := h.Percentile(100); got != 10000*1000 {
+		t.Errorf("p100 = %d, want the max", got)
+	}
+}
+
+func TestHistogramRecordNegative(t *testing.T) {
+	h := NewHistogram()
+	h.Record(-5)
+	h.RecordN(3, 0)
+	if h.Count != 1 || h.Min != 0 || h.Max != 0 {
+		t.Errorf("histogram %+v", h)
+	}
+}
+
+func TestHistogramSub(t *testing.T) {
+	previous := NewHistogram()
+	for v := int64(1); v <= 10; v++ {
+		previous.Record(v)
+	}
+	current := previous.Clone()
+	current.Record(50)
+	current.Record(60)
+
+	delta := current.Sub(previous)
+	if delta.Count != 2 || delta.Sum != 110 || delta.Min != 50 || delta.Max != 60 {
+		t.Errorf("delta %+v", delta)
+	}
+	if got := delta.Percentile(50); got != 50 {
+		t.Errorf("p50 of the delta = %d, want 50", got)
+	}
+
+	// nothing recorded since previous
+	if empty := previous.Sub(previous); empty.Count != 0 {
+		t.Errorf("delta of the same histogram %+v", empty)
+	}
+
+	// no previous, or current was reset after it: the delta is the whole current
+	if whole := current.Sub(nil); whole.Count != current.Count {
+		t.Errorf("delta from nil %+v", whole)
+	}
+	reset := NewHistogram()
+	reset.Record(3)
+	if whole := reset.Sub(previous); whole.Count != 1 || whole.Max != 3 {
+		t.Errorf("delta of a reset histogram %+v", whole)
+	}
+	other := NewHistogram()
+	for v := int64(0); v < 20; v++ {
+		other.Record(100)
+	}
+	if whole := other.Sub(previous); whole.Count != 20 {
+		t.Errorf("delta of an unrelated histogram %+v", whole)
+	}
+	// Sub does not modify its operands
+	if current.Count != 12 || previous.Count != 10 {
+		t.Error("Sub modified the histograms")
+	}
+}
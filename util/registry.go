@@ -0,0 +1,279 @@
+package util
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// MetricType tells how a metric is accumulated, merged across agents and turned into rates.
+type MetricType string
+
+const (
+	// MetricCounter only accumulates. Counters of the agents are summed and their rates are meaningful.
+	MetricCounter MetricType = "counter"
+	// MetricGauge is a current value that goes up and down, e.g. the established connections.
+	// Gauges of the agents are summed but they have no rate.
+	MetricGauge MetricType = "gauge"
+	// MetricHistogram is a distribution of values. Histograms of the agents are merged bucket by bucket.
+	MetricHistogram MetricType = "histogram"
+)
+
+type metric interface {
+	Type() MetricType
+}
+
+// CounterMetric is a monotonic count.
+type CounterMetric struct {
+	name  string
+	value int64
+}
+
+func (m *CounterMetric) Type() MetricType {
+	return MetricCounter
+}
+
+// Add increases the counter. A negative delta is a misuse, a value going down is a gauge,
+// so it is logged and ignored.
+func (m *CounterMetric) Add(delta int64) {
+	if delta > 0 {
+		atomic.AddInt64(&m.value, delta)
+	} else if delta < 0 {
+		log.Printf("[Error] Counter %s is decreased by %d", m.name, -delta)
+	}
+}
+
+func (m *CounterMetric) Value() int64 {
+	return atomic.LoadInt64(&m.value)
+}
+
+// GaugeMetric is a value that goes up and down.
+type GaugeMetric struct {
+	value int64
+}
+
+func (m *GaugeMetric) Type() MetricType {
+	return MetricGauge
+}
+
+func (m *GaugeMetric) Add(delta int64) {
+	atomic.AddInt64(&m.value, delta)
+}
+
+func (m *GaugeMetric) Set(value int64) {
+	atomic.StoreInt64(&m.value, value)
+}
+
+func (m *GaugeMetric) Value() int64 {
+	return atomic.LoadInt64(&m.value)
+}
+
+// histogramShards is the number of independently locked histograms behind a histogram metric,
+// so that concurrent producers rarely wait for each other.
+const histogramShards = 16
+
+type histogramShard struct {
+	lock      sync.Mutex
+	histogram *Histogram
+	// pad the shard to its own cache line to avoid false sharing between shards
+	_ [48]byte
+}
+
+// HistogramMetric is a sharded Histogram that can be recorded from multiple routines.
+type HistogramMetric struct {
+	next   uint32
+	shards [histogramShards]histogramShard
+}
+
+func newHistogramMetric() *HistogramMetric {
+	m := new(HistogramMetric)
+	for i := range m.shards {
+		m.shards[i].histogram = NewHistogram()
+	}
+	return m
+}
+
+func (m *HistogramMetric) Type() MetricType {
+	return MetricHistogram
+}
+
+func (m *HistogramMetric) Record(value int64) {
+	shard := &m.shards[atomic.AddUint32(&m.next, 1)%histogramShards]
+	shard.lock.Lock()
+	shard.histogram.Record(value)
+	shard.lock.Unlock()
+}
+
+// Snapshot merges the shards into a new Histogram.
+func (m *HistogramMetric) Snapshot() *Histogram {
+	result := NewHistogram()
+	for i := range m.shards {
+		shard := &m.shards[i]
+		shard.lock.Lock()
+		result.Merge(shard.histogram)
+		shard.lock.Unlock()
+	}
+	return result
+}
+
+// Registry is a thread safe store of named, typed metrics.
+// Metrics are looked up from a lock free map and updated atomically, so producers on many
+// routines do not serialize on a single consumer.
+type Registry struct {
+	metrics sync.Map // map[string]metric
+	stopped int32
+}
+
+func NewRegistry() *Registry {
+	return new(Registry)
+}
+
+func (r *Registry) isStopped() bool {
+	return atomic.LoadInt32(&r.stopped) != 0
+}
+
+func (r *Registry) get(name string, create func() metric) metric {
+	if m, ok := r.metrics.Load(name); ok {
+		return m.(metric)
+	}
+	m, _ := r.metrics.LoadOrStore(name, create())
+	return m.(metric)
+}
+
+// Counter returns the counter with the given name, creating it if needed.
+// A detached counter is returned if the registry is stopped or the name is taken by another type.
+func (r *Registry) Counter(name string) *CounterMetric {
+	if r.isStopped() {
+		return &CounterMetric{name: name}
+	}
+	m, ok := r.get(name, func() metric { return &CounterMetric{name: name} }).(*CounterMetric)
+	if !ok {
+		log.Printf("[Error] Metric %s is not a %s", name, MetricCounter)
+		return &CounterMetric{name: name}
+	}
+	return m
+}
+
+// Gauge returns the gauge with the given name, creating it if needed.
+// A detached gauge is returned if the registry is stopped or the name is taken by another type.
+func (r *Registry) Gauge(name string) *GaugeMetric {
+	if r.isStopped() {
+		return new(GaugeMetric)
+	}
+	m, ok := r.get(name, func() metric { return new(GaugeMetric) }).(*GaugeMetric)
+	if !ok {
+		log.Printf("[Error] Metric %s is not a %s", name, MetricGauge)
+		return new(GaugeMetric)
+	}
+	return m
+}
+
+// Histogram returns the histogram with the given name, creating it if needed.
+// A detached histogram is returned if the registry is stopped or the name is taken by another type.
+func (r *Registry) Histogram(name string) *HistogramMetric {
+	if r.isStopped() {
+		return newHistogramMetric()
+	}
+	m, ok := r.get(name, func() metric { return newHistogramMetric() }).(*HistogramMetric)
+	if !ok {
+		log.Printf("[Error] Metric %s is not a %s", name, MetricHistogram)
+		return newHistogramMetric()
+	}
+	return m
+}
+
+// Snapshot takes a copy of the current value of all the metrics.
+func (r *Registry) Snapshot() *MetricsSnapshot {
+	snapshot := NewMetricsSnapshot()
+	if r.isStopped() {
+		return snapshot
+	}
+	r.metrics.Range(func(k, v interface{}) bool {
+		name := k.(string)
+		switch m := v.(type) {
+		case *CounterMetric:
+			snapshot.Counters[name] = m.Value()
+		case *GaugeMetric:
+			snapshot.Gauges[name] = m.Value()
+		case *HistogramMetric:
+			snapshot.Histograms[name] = m.Snapshot()
+		}
+		return true
+	})
+	return snapshot
+}
+
+// Clear removes all metrics whose names start with prefix.
+// Updates racing with Clear may be counted either before or after the reset.
+func (r *Registry) Clear(prefix string) {
+	r.metrics.Range(func(k, v interface{}) bool {
+		if strings.HasPrefix(k.(string), prefix) {
+			r.metrics.Delete(k)
+		}
+		return true
+	})
+}
+
+// Stop closes the registry and it will not accumulate future records.
+// Snapshots of a stopped registry are empty. It is safe to call Stop more than once.
+func (r *Registry) Stop() {
+	atomic.StoreInt32(&r.stopped, 1)
+}
+
+// MetricsSnapshot is the value of the metrics at a moment, grouped by metric type.
+// It is transferred from the agents to the master through net/rpc.
+type MetricsSnapshot struct {
+	Counters   map[string]int64
+	Gauges     map[string]int64
+	Histograms map[string]*Histogram
+}
+
+func NewMetricsSnapshot() *MetricsSnapshot {
+	return &MetricsSnapshot{
+		Counters:   make(map[string]int64),
+		Gauges:     make(map[string]int64),
+		Histograms: make(map[string]*Histogram),
+	}
+}
+
+// Merge adds the metrics of other into s: counters and gauges are summed and histograms are merged.
+func (s *MetricsSnapshot) Merge(other *MetricsSnapshot) {
+	if other == nil {
+		return
+	}
+	for k, v := range other.Counters {
+		s.Counters[k] += v
+	}
+	for k, v := range other.Gauges {
+		s.Gauges[k] += v
+	}
+	for k, v := range other.Histograms {
+		if _, ok := s.Histograms[k]; !ok {
+			s.Histograms[k] = NewHistogram()
+		}
+		s.Histograms[k].Merge(v)
+	}
+}
+
+// Type returns the type of the named metric and whether it exists.
+func (s *MetricsSnapshot) Type(name string) (MetricType, bool) {
+	if _, ok := s.Counters[name]; ok {
+		return MetricCounter, true
+	}
+	if _, ok := s.Gauges[name]; ok {
+		return MetricGauge, true
+	}
+	if _, ok := s.Histograms[name]; ok {
+		return MetricHistogram, true
+	}
+	return "", false
+}
+
+// Value returns the value of a counter or gauge, or 0 if there is none.
+func (s *MetricsSnapshot) Value(name string) int64 {
+	if v, ok := s.Counters[name]; ok {
+		return v
+	}
+	return s.Gauges[name]
+}
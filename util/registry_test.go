@@ -0,0 +1,300 @@
+package util
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// channelCounter mirrors the former single consumer design of the counter store,
+// where every Stat goes through one unbuffered channel, as a baseline for the benchmarks.
+type channelCounter struct {
+	stats   map[string]int64
+	records chan countRecord
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+type countRecord struct {
+	name  string
+	value int64
+}
+
+func newChannelCounter() *channelCounter {
+	c := &channelCounter{
+		stats:   make(map[string]int64),
+		records: make(chan countRecord),
+		done:    make(chan struct{}),
+	}
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		for {
+			select {
+			case r := <-c.records:
+				c.stats[r.name] += r.value
+			case <-c.done:
+				return
+			}
+		}
+	}()
+	return c
+}
+
+func (c *channelCounter) Stat(name string, value int64) {
+	c.records <- countRecord{name, value}
+}
+
+func (c *channelCounter) Stop() {
+	close(c.done)
+	c.wg.Wait()
+}
+
+var benchNames = []string{
+	"message:sent",
+	"message:received",
+	"message:sendSize",
+	"message:recvSize",
+}
+
+func BenchmarkChannelCounterStatParallel(b *testing.B) {
+	c := newChannelCounter()
+	defer c.Stop()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			c.Stat(benchNames[i%len(benchNames)], 1)
+			i++
+		}
+	})
+}
+
+func BenchmarkRegistryCounterParallel(b *testing.B) {
+	r := NewRegistry()
+	defer r.Stop()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			r.Counter(benchNames[i%len(benchNames)]).Add(1)
+			i++
+		}
+	})
+}
+
+func BenchmarkRegistryCounterParallelSingleKey(b *testing.B) {
+	r := NewRegistry()
+	defer r.Stop()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			r.Counter("message:sent").Add(1)
+		}
+	})
+}
+
+func BenchmarkRegistryGaugeParallel(b *testing.B) {
+	r := NewRegistry()
+	defer r.Stop()
+	b.RunParallel(func(pb *testing.PB) {
+		var delta int64 = 1
+		for pb.Next() {
+			r.Gauge("connection:established").Add(delta)
+			delta = -delta
+		}
+	})
+}
+
+func BenchmarkRegistryHistogramParallel(b *testing.B) {
+	r := NewRegistry()
+	defer r.Stop()
+	b.RunParallel(func(pb *testing.PB) {
+		var latency int64
+		for pb.Next() {
+			r.Histogram("message").Record(latency % 100000)
+			latency += 7919
+		}
+	})
+}
+
+func BenchmarkRegistryCounterWithSnapshots(b *testing.B) {
+	r := NewRegistry()
+	defer r.Stop()
+	for i := 0; i < 64; i++ {
+		r.Gauge("connection:" + strconv.Itoa(i)).Add(1)
+	}
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				r.Snapshot()
+			}
+		}
+	}()
+	defer close(done)
+
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			r.Counter(benchNames[i%len(benchNames)]).Add(1)
+			i++
+		}
+	})
+}
+
+func TestRegistryCounterAndGauge(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("message:sent").Add(2)
+	r.Counter("message:sent").Add(3)
+	// counters are monotonic, a decrease is logged
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	r.Counter("message:sent").Add(-10)
+	log.SetOutput(os.Stderr)
+	if !strings.Contains(logged.String(), "Counter message:sent is decreased by 10") {
+		t.Errorf("the decrease of a counter is not logged: %q", logged.String())
+	}
+	r.Gauge("connection:established").Add(5)
+	r.Gauge("connection:established").Add(-2)
+
+	snapshot := r.Snapshot()
+	if v := snapshot.Counters["message:sent"]; v != 5 {
+		t.Errorf("message:sent = %d, want 5", v)
+	}
+	if v := snapshot.Gauges["connection:established"]; v != 3 {
+		t.Errorf("connection:established = %d, want 3", v)
+	}
+	if typ, ok := snapshot.Type("message:sent"); !ok || typ != MetricCounter {
+		t.Errorf("type of message:sent = %s, %v", typ, ok)
+	}
+	if typ, ok := snapshot.Type("connection:established"); !ok || typ != MetricGauge {
+		t.Errorf("type of connection:established = %s, %v", typ, ok)
+	}
+	if _, ok := snapshot.Type("missing"); ok {
+		t.Error("missing metric exists")
+	}
+	if v := snapshot.Value("connection:established"); v != 3 {
+		t.Errorf("Value of the gauge = %d, want 3", v)
+	}
+}
+
+func TestRegistryConcurrentCounter(t *testing.T) {
+	r := NewRegistry()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				r.Counter("message:received").Add(1)
+				r.Histogram("message").Record(int64(j))
+			}
+		}()
+	}
+	wg.Wait()
+	snapshot := r.Snapshot()
+	if v := snapshot.Counters["message:received"]; v != 8000 {
+		t.Errorf("message:received = %d, want 8000", v)
+	}
+	if h := snapshot.Histograms["message"]; h.Count != 8000 || h.Min != 0 || h.Max != 999 {
+		t.Errorf("message histogram count %d min %d max %d", h.Count, h.Min, h.Max)
+	}
+}
+
+func TestRegistryTypeConflict(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("connection").Add(1)
+	// the name is taken by the counter, so the gauge is detached
+	r.Gauge("connection").Add(7)
+	snapshot := r.Snapshot()
+	if snapshot.Counters["connection"] != 1 {
+		t.Errorf("connection counter = %d, want 1", snapshot.Counters["connection"])
+	}
+	if _, ok := snapshot.Gauges["connection"]; ok {
+		t.Error("conflicting gauge is in the snapshot")
+	}
+}
+
+func TestRegistryClear(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("message:sent").Add(1)
+	r.Histogram("message").Record(10)
+	r.Gauge("connection:established").Add(1)
+
+	r.Clear("message")
+	snapshot := r.Snapshot()
+	if _, ok := snapshot.Type("message:sent"); ok {
+		t.Error("message:sent is not cleared")
+	}
+	if _, ok := snapshot.Type("message"); ok {
+		t.Error("message histogram is not cleared")
+	}
+	if snapshot.Gauges["connection:established"] != 1 {
+		t.Error("connection:established is cleared")
+	}
+
+	// cleared metrics start again from 0
+	r.Counter("message:sent").Add(2)
+	if v := r.Snapshot().Counters["message:sent"]; v != 2 {
+		t.Errorf("message:sent = %d after clear, want 2", v)
+	}
+
+	r.Clear("")
+	if snapshot := r.Snapshot(); len(snapshot.Counters)+len(snapshot.Gauges)+len(snapshot.Histograms) != 0 {
+		t.Errorf("metrics left after clearing all: %+v", snapshot)
+	}
+}
+
+func TestRegistryStop(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("message:sent").Add(1)
+	r.Stop()
+	r.Stop()
+	r.Counter("message:sent").Add(1)
+	r.Histogram("message").Record(1)
+	if snapshot := r.Snapshot(); len(snapshot.Counters)+len(snapshot.Gauges)+len(snapshot.Histograms) != 0 {
+		t.Errorf("snapshot of a stopped registry is not empty: %+v", snapshot)
+	}
+}
+
+func TestMetricsSnapshotMerge(t *testing.T) {
+	a := NewMetricsSnapshot()
+	a.Counters["message:sent"] = 3
+	a.Gauges["connection:established"] = 10
+	a.Histograms["message"] = NewHistogram()
+	a.Histograms["message"].Record(100)
+
+	b := NewMetricsSnapshot()
+	b.Counters["message:sent"] = 4
+	b.Counters["message:received"] = 2
+	b.Gauges["connection:established"] = 5
+	b.Histograms["message"] = NewHistogram()
+	b.Histograms["message"].Record(50)
+	b.Histograms["connection:dial"] = NewHistogram()
+	b.Histograms["connection:dial"].Record(7)
+
+	a.Merge(b)
+	a.Merge(nil)
+	if a.Counters["message:sent"] != 7 || a.Counters["message:received"] != 2 {
+		t.Errorf("merged counters %v", a.Counters)
+	}
+	if a.Gauges["connection:established"] != 15 {
+		t.Errorf("merged gauges %v", a.Gauges)
+	}
+	if h := a.Histograms["message"]; h.Count != 2 || h.Min != 50 || h.Max != 100 || h.Sum != 150 {
+		t.Errorf("merged message histogram %+v", h)
+	}
+	if h := a.Histograms["connection:dial"]; h.Count != 1 || h.Max != 7 {
+		t.Errorf("merged connection:dial histogram %+v", h)
+	}
+	// the merged histogram is a copy
+	b.Histograms["connection:dial"].Record(8)
+	if a.Histograms["connection:dial"].Count != 1 {
+		t.Error("merged histogram shares the buckets of the source")
+	}
+}